@@ -0,0 +1,267 @@
+// Package cache implements a local content-addressed store of exec
+// results. An entry is keyed on the command, its environment and the
+// contents of its declared inputs, and records the declared outputs
+// together with the output the command printed.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const manifestName = "manifest.json"
+
+type Cache struct {
+	Dir string
+}
+
+func New(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// Entry is the manifest of a cached exec result.
+type Entry struct {
+	Key     string   `json:"key"`
+	Stdout  []string `json:"stdout"`
+	Outputs []string `json:"outputs"`
+}
+
+// Stats summarises the contents of the cache.
+type Stats struct {
+	Entries int
+	Files   int
+	Size    int64
+}
+
+// Key calculates the cache key of a command run in dir. The inputs are
+// path patterns relative to dir and the contents of every matching file
+// is added to the key.
+func Key(cmd []string, env map[string]string, dir string, inputs []string) (string, error) {
+	h := sha256.New()
+
+	for _, arg := range cmd {
+		fmt.Fprintf(h, "cmd\x00%s\x00", arg)
+	}
+
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(h, "env\x00%s=%s\x00", k, env[k])
+	}
+
+	files, err := expand(dir, inputs)
+	if err != nil {
+		return "", err
+	}
+
+	for _, file := range files {
+		f, err := os.Open(filepath.Join(dir, file))
+		if err != nil {
+			return "", fmt.Errorf("opening input, %w", err)
+		}
+
+		fmt.Fprintf(h, "input\x00%s\x00", filepath.ToSlash(file))
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", fmt.Errorf("reading input, %w", err)
+		}
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Get returns the entry for the key. The boolean is false if the
+// cache has no entry for the key.
+func (c *Cache) Get(key string) (*Entry, bool, error) {
+	b, err := os.ReadFile(filepath.Join(c.Dir, key, manifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("reading manifest, %w", err)
+	}
+
+	e := &Entry{}
+	err = json.Unmarshal(b, e)
+	if err != nil {
+		return nil, false, fmt.Errorf("decoding manifest, %w", err)
+	}
+
+	return e, true, nil
+}
+
+// Put stores the outputs found in dir and the recorded stdout under
+// the key. The outputs are path patterns relative to dir.
+func (c *Cache) Put(key string, stdout []string, dir string, outputs []string) error {
+	files, err := expand(dir, outputs)
+	if err != nil {
+		return err
+	}
+
+	entryDir := filepath.Join(c.Dir, key)
+	err = os.RemoveAll(entryDir)
+	if err != nil {
+		return fmt.Errorf("clearing entry, %w", err)
+	}
+
+	for _, file := range files {
+		err = copyFile(filepath.Join(dir, file), filepath.Join(entryDir, "files", file))
+		if err != nil {
+			return err
+		}
+	}
+
+	b, err := json.Marshal(&Entry{
+		Key:     key,
+		Stdout:  stdout,
+		Outputs: files,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding manifest, %w", err)
+	}
+
+	err = os.WriteFile(filepath.Join(entryDir, manifestName), b, 0644)
+	if err != nil {
+		return fmt.Errorf("writing manifest, %w", err)
+	}
+
+	return nil
+}
+
+// Restore copies the outputs of the entry back into dir. Outputs that
+// are not inside dir are refused.
+func (c *Cache) Restore(e *Entry, dir string) error {
+	for _, file := range e.Outputs {
+		if !filepath.IsLocal(file) {
+			return fmt.Errorf("output %s is outside of the directory", file)
+		}
+	}
+
+	for _, file := range e.Outputs {
+		err := copyFile(filepath.Join(c.Dir, e.Key, "files", file), filepath.Join(dir, file))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats counts the entries, files and bytes held by the cache.
+func (c *Cache) Stats() (Stats, error) {
+	s := Stats{}
+
+	err := filepath.WalkDir(c.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		s.Size += info.Size()
+
+		if d.Name() == manifestName && filepath.Dir(filepath.Dir(path)) == filepath.Clean(c.Dir) {
+			s.Entries++
+		} else {
+			s.Files++
+		}
+		return nil
+	})
+	if err != nil {
+		return s, fmt.Errorf("walking cache, %w", err)
+	}
+
+	return s, nil
+}
+
+// Clean removes all entries from the cache.
+func (c *Cache) Clean() error {
+	return os.RemoveAll(c.Dir)
+}
+
+// expand returns the files matching the patterns relative to dir.
+// Patterns and files that are not inside dir are refused.
+func expand(dir string, patterns []string) ([]string, error) {
+	files := []string{}
+	seen := map[string]bool{}
+
+	for _, pattern := range patterns {
+		if !filepath.IsLocal(pattern) {
+			return nil, fmt.Errorf("pattern %s is outside of the directory", pattern)
+		}
+
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("matching %s, %w", pattern, err)
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if info.IsDir() {
+				continue
+			}
+
+			rel, err := filepath.Rel(dir, match)
+			if err != nil {
+				return nil, err
+			}
+			if !filepath.IsLocal(rel) {
+				return nil, fmt.Errorf("file %s is outside of the directory", match)
+			}
+			if !seen[rel] {
+				seen[rel] = true
+				files = append(files, rel)
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+func copyFile(src, dst string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("opening %s, %w", src, err)
+	}
+	defer r.Close()
+
+	err = os.MkdirAll(filepath.Dir(dst), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("creating directory, %w", err)
+	}
+
+	w, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("creating %s, %w", dst, err)
+	}
+
+	_, err = io.Copy(w, r)
+	if err != nil {
+		w.Close()
+		return fmt.Errorf("copying %s, %w", src, err)
+	}
+
+	return w.Close()
+}
@@ -0,0 +1,114 @@
+package cache_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/oligoden/meta/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKey(t *testing.T) {
+	assert := assert.New(t)
+
+	if err := os.MkdirAll("testing", 0755); err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll("testing")
+
+	if err := ioutil.WriteFile("testing/a.ext", []byte("a"), 0644); err != nil {
+		t.Error(err)
+	}
+
+	cmd := []string{"cp", "a.ext", "b.ext"}
+	env := map[string]string{"A": "a", "B": "b"}
+
+	key1, err := cache.Key(cmd, env, "testing", []string{"*.ext"})
+	assert.NoError(err)
+	key2, err := cache.Key(cmd, env, "testing", []string{"a.ext"})
+	assert.NoError(err)
+	assert.Equal(key1, key2)
+
+	key2, err = cache.Key(cmd, map[string]string{"A": "a"}, "testing", []string{"a.ext"})
+	assert.NoError(err)
+	assert.NotEqual(key1, key2)
+
+	if err := ioutil.WriteFile("testing/a.ext", []byte("b"), 0644); err != nil {
+		t.Error(err)
+	}
+	key2, err = cache.Key(cmd, env, "testing", []string{"a.ext"})
+	assert.NoError(err)
+	assert.NotEqual(key1, key2)
+}
+
+func TestPutRestore(t *testing.T) {
+	assert := assert.New(t)
+
+	if err := os.MkdirAll("testing/work/sub", 0755); err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll("testing")
+
+	if err := ioutil.WriteFile("testing/work/sub/b.ext", []byte("b"), 0644); err != nil {
+		t.Error(err)
+	}
+
+	c := cache.New("testing/cache")
+
+	_, hit, err := c.Get("abc")
+	assert.NoError(err)
+	assert.False(hit)
+
+	assert.NoError(c.Put("abc", []string{"line"}, "testing/work", []string{"sub/*.ext"}))
+	assert.NoError(os.RemoveAll("testing/work"))
+
+	e, hit, err := c.Get("abc")
+	assert.NoError(err)
+	if assert.True(hit) {
+		assert.Equal([]string{"line"}, e.Stdout)
+		assert.NoError(c.Restore(e, "testing/work"))
+	}
+
+	content, err := ioutil.ReadFile("testing/work/sub/b.ext")
+	if assert.NoError(err) {
+		assert.Equal("b", string(content))
+	}
+
+	s, err := c.Stats()
+	assert.NoError(err)
+	assert.Equal(1, s.Entries)
+	assert.Equal(1, s.Files)
+
+	assert.NoError(c.Clean())
+	s, err = c.Stats()
+	assert.NoError(err)
+	assert.Equal(0, s.Entries)
+}
+
+func TestOutsidePaths(t *testing.T) {
+	assert := assert.New(t)
+
+	if err := os.MkdirAll("testing/work", 0755); err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll("testing")
+
+	if err := ioutil.WriteFile("testing/a.ext", []byte("a"), 0644); err != nil {
+		t.Error(err)
+	}
+
+	c := cache.New("testing/cache")
+
+	_, err := cache.Key([]string{"cp"}, nil, "testing/work", []string{"../a.ext"})
+	assert.EqualError(err, "pattern ../a.ext is outside of the directory")
+
+	err = c.Put("abc", nil, "testing/work", []string{"../../x"})
+	assert.EqualError(err, "pattern ../../x is outside of the directory")
+
+	err = c.Put("abc", nil, "testing/work", []string{"/etc/*"})
+	assert.EqualError(err, "pattern /etc/* is outside of the directory")
+
+	err = c.Restore(&cache.Entry{Key: "abc", Outputs: []string{"../a.ext"}}, "testing/work")
+	assert.EqualError(err, "output ../a.ext is outside of the directory")
+}
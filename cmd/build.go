@@ -7,9 +7,13 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/oligoden/meta/entity"
+	"github.com/oligoden/meta/helper"
+	"github.com/oligoden/meta/profile"
 	"github.com/oligoden/meta/refmap"
+	"github.com/oligoden/meta/report"
 
 	"github.com/spf13/cobra"
 )
@@ -24,117 +28,156 @@ Refer to 'meta up' to keep running and watch for changes.
 See https://oligoden.com/meta for more information.`,
 
 	Run: func(cmd *cobra.Command, args []string) {
-		metaFileName, err := cmd.Flags().GetString("metafile")
-		if err != nil {
-			fmt.Println("error getting config filename flag,", err)
-			os.Exit(1)
-		}
-
-		verboseValue, _ := cmd.Flags().GetInt("verbose")
-		if verboseValue > 0 {
-			fmt.Println("verbosity level", verboseValue)
-		}
-
-		_, err = os.Stat(metaFileName)
-		if errors.Is(err, os.ErrNotExist) {
-			fmt.Printf("project config \"%s\" not found\n", metaFileName)
-			os.Exit(0)
-		}
-
-		e := entity.NewProject()
-		err = e.LoadFile(metaFileName)
-		if err != nil {
-			fmt.Println("error loading project config,", err)
+		// failures are logged by build, which returns after its deferred
+		// cleanup, such as stopping the helpers, so that the exit status
+		// can report them
+		if build(cmd) != nil {
 			os.Exit(1)
 		}
+	},
+}
 
-		metaOverrideFileName := strings.TrimSuffix(metaFileName, filepath.Ext(metaFileName)) + ".override" + filepath.Ext(metaFileName)
-		if _, err := os.Stat(metaOverrideFileName); err == nil {
-			err = e.LoadFile(metaOverrideFileName)
-			if err != nil {
-				fmt.Println("error loading project config,", err)
-				os.Exit(1)
-			}
-		} else if errors.Is(err, os.ErrNotExist) {
-			if verboseValue >= 1 {
-				fmt.Println("no config override file used")
-			}
-		} else {
-			fmt.Println("error loading project config override,", err)
-			fmt.Println("continuing with normal config")
-		}
-
-		if verboseValue >= 1 {
-			if e.Environment != "" {
-				fmt.Println("environment:", e.Environment)
-			} else {
-				fmt.Println("no environment set")
-			}
-		}
-
-		origLocation, err := cmd.Flags().GetString("orig")
-		if err != nil {
-			fmt.Println("error getting origin flag,", err)
-			os.Exit(1)
-		}
-
-		if origLocation == "" {
-			origLocation = e.OrigLocation
-		}
-
-		destLocation, err := cmd.Flags().GetString("dest")
+// build builds the project once. A missing config is not a failure.
+func build(cmd *cobra.Command) error {
+	logger, err := newLogger(cmd)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	metaFileName, err := cmd.Flags().GetString("metafile")
+	if err != nil {
+		logger.Error("error getting config filename flag", "err", err)
+		return err
+	}
+
+	_, err = os.Stat(metaFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Error("project config not found", "file", metaFileName)
+		return nil
+	}
+
+	e := entity.NewProject()
+	err = e.LoadFile(metaFileName)
+	if err != nil {
+		logger.Error("error loading project config", "file", metaFileName, "err", err)
+		return err
+	}
+
+	metaOverrideFileName := strings.TrimSuffix(metaFileName, filepath.Ext(metaFileName)) + ".override" + filepath.Ext(metaFileName)
+	if _, err := os.Stat(metaOverrideFileName); err == nil {
+		err = e.LoadFile(metaOverrideFileName)
 		if err != nil {
-			fmt.Println("error getting destination flag,", err)
-			os.Exit(1)
+			logger.Error("error loading project config", "file", metaOverrideFileName, "err", err)
+			return err
 		}
-
-		if destLocation == "" {
-			destLocation = e.DestLocation
+	} else if errors.Is(err, os.ErrNotExist) {
+		logger.Debug("no config override file used")
+	} else {
+		logger.Warn("error loading project config override, continuing with normal config", "err", err)
+	}
+
+	if e.Environment != "" {
+		logger.Debug("environment set", "environment", e.Environment)
+	} else {
+		logger.Debug("no environment set")
+	}
+
+	origLocation, err := cmd.Flags().GetString("orig")
+	if err != nil {
+		logger.Error("error getting origin flag", "err", err)
+		return err
+	}
+
+	if origLocation == "" {
+		origLocation = e.OrigLocation
+	}
+
+	destLocation, err := cmd.Flags().GetString("dest")
+	if err != nil {
+		logger.Error("error getting destination flag", "err", err)
+		return err
+	}
+
+	if destLocation == "" {
+		destLocation = e.DestLocation
+	}
+
+	ctx := context.WithValue(context.Background(), refmap.ContextKey("orig"), origLocation)
+	ctx = context.WithValue(ctx, refmap.ContextKey("dest"), destLocation)
+	metaDir, _ := cmd.Flags().GetString("meta")
+	ctx = context.WithValue(ctx, refmap.ContextKey("meta"), metaDir)
+
+	// the helpers are started while processing the project
+	helpers := helper.NewSet()
+	defer helpers.Close()
+	ctx = context.WithValue(ctx, refmap.ContextKey("helpers"), helpers)
+	ctx = withLogger(ctx, cmd, logger)
+	prof := profile.New()
+	ctx = context.WithValue(ctx, refmap.ContextKey("profile"), prof)
+	start := time.Now()
+
+	// the configuration is processed and graph build
+	logger.Info("processing")
+	rm := refmap.Start()
+
+	err = phase(ctx, "process", func() error {
+		return e.Process(&entity.ProjectBranch{}, rm, ctx)
+	})
+	if err != nil {
+		logger.Error("error processing project", "phase", "process", "err", err)
+		return err
+	}
+
+	err = phase(ctx, "evaluate", rm.Evaluate)
+	if err != nil {
+		logger.Error("error evaluating graph", "phase", "evaluate", "err", err)
+		return err
+	}
+	rm.Output()
+
+	logger.Info("building")
+	r := report.New(e.Name)
+	before := nodeStates(rm)
+	phase(ctx, "perform", func() error {
+		for _, run := range rm.ChangedRuns() {
+			duration, err := perform(ctx, rm, run)
+			r.Add(newRecord(ctx, run.Ref, duration, err))
 		}
-
-		ctx := context.WithValue(context.Background(), refmap.ContextKey("orig"), origLocation)
-		ctx = context.WithValue(ctx, refmap.ContextKey("dest"), destLocation)
-		ctx = context.WithValue(ctx, refmap.ContextKey("verbose"), verboseValue)
-
-		// the configuration is processed and graph build
-		fmt.Println("processing...")
-		rm := refmap.Start()
-
-		pb := &entity.ProjectBranch{}
-		err = e.Process(pb, rm, ctx)
+		return nil
+	})
+	err = saveCauses(ctx, metaDir, rm.Causes())
+	if err != nil {
+		logger.Error("error saving causes", "err", err)
+	}
+	rm.Assess()
+	rm.Finish()
+	finishReport(r, before, nodeStates(rm), prof)
+	r.Duration = time.Since(start)
+
+	performed := r.Count(report.Built) + r.Count(report.Failed) + r.Count(report.Removed)
+	logger.Log(ctx, levelSummary, "done", "nodes", performed, "failed", r.Count(report.Failed), "duration", r.Duration)
+	slowest, _ := cmd.Flags().GetInt("slowest")
+	logSlowest(ctx, prof, slowest)
+
+	reportPath, _ := cmd.Flags().GetString("report")
+	if reportPath != "" {
+		err = r.Write(reportPath)
 		if err != nil {
-			fmt.Println("error processing project,", err)
-			os.Exit(1)
+			logger.Error("error writing report", "err", err)
+			return err
 		}
+	}
 
-		err = rm.Evaluate()
+	profilePath, _ := cmd.Flags().GetString("profile")
+	if profilePath != "" {
+		err = writeTrace(prof, profilePath)
 		if err != nil {
-			fmt.Println("error evaluating graph,", err)
-			os.Exit(1)
+			logger.Error("error writing profile", "err", err)
+			return err
 		}
-		rm.Output()
-
-		fmt.Println("building...")
-		for _, ref := range rm.ChangedRefs() {
-			if verboseValue >= 2 {
-				fmt.Println("performing", ref.Identifier())
-			}
-
-			err = ref.Perform(rm, ctx)
-			if err != nil {
-				fmt.Println("error performing actions on", ref.Identifier(), err)
-				fmt.Println(ref.Output())
-			}
-
-			if ref.Output() != "" {
-				fmt.Println(ref.Output())
-			}
-		}
-		rm.Assess()
-		rm.Finish()
-
-		fmt.Println("done")
-	},
+	}
+	return nil
 }
 
 func init() {
@@ -144,5 +187,9 @@ func init() {
 	buildCmd.Flags().String("dest", "", "The base destination directory")
 	buildCmd.Flags().String("orig", "", "The base origin directory")
 	buildCmd.Flags().BoolP("force", "f", false, "Force rebuilding of existing files")
-	buildCmd.Flags().IntP("verbose", "v", 0, "Set verbosity to 1, 2 or 3")
+	addLogFlags(buildCmd)
+	buildCmd.Flags().String("meta", ".meta", "The meta state directory")
+	buildCmd.Flags().Int("slowest", 5, "The number of slowest nodes shown in the summary")
+	buildCmd.Flags().String("profile", "", "Write a Chrome trace-event file of the build to the file")
+	buildCmd.Flags().String("report", "", "Write a report of the nodes to the file, as JUnit XML for .xml files and JSON otherwise")
 }
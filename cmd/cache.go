@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/oligoden/meta/cache"
+	"github.com/spf13/cobra"
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the exec result cache",
+	Long: `Execs with "cache" set store their declared outputs and printed
+output in the local cache under .meta/cache, keyed on the command,
+environment and declared input contents.
+
+See https://oligoden.com/meta for more information.`,
+}
+
+// cacheCleanCmd represents the cache clean command
+var cacheCleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove all cached exec results",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		metaDir, _ := cmd.Flags().GetString("meta")
+
+		err := cache.New(filepath.Join(metaDir, "cache")).Clean()
+		if err != nil {
+			fmt.Println("error cleaning cache,", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("cache cleaned")
+	},
+}
+
+// cacheStatsCmd represents the cache stats command
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show the size of the exec result cache",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		metaDir, _ := cmd.Flags().GetString("meta")
+
+		s, err := cache.New(filepath.Join(metaDir, "cache")).Stats()
+		if err != nil {
+			fmt.Println("error reading cache,", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("entries:", s.Entries)
+		fmt.Println("files:  ", s.Files)
+		fmt.Println("size:   ", s.Size, "bytes")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheCleanCmd)
+	cacheCmd.AddCommand(cacheStatsCmd)
+
+	cacheCmd.PersistentFlags().String("meta", ".meta", "The meta state directory")
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/oligoden/meta/ctl"
+	"github.com/spf13/cobra"
+)
+
+// ctlCmd represents the ctl command
+var ctlCmd = &cobra.Command{
+	Use:   "ctl",
+	Short: "Control a running meta up session",
+	Long: `meta ctl talks to a running meta up session over the control
+socket in the meta state directory (.meta/up.sock by default).
+
+See https://oligoden.com/meta for more information.`,
+}
+
+// ctlRebuildCmd represents the ctl rebuild command
+var ctlRebuildCmd = &cobra.Command{
+	Use:   "rebuild",
+	Short: "Reload the config and rebuild all nodes",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		err := dialCtl(cmd).Rebuild()
+		if err != nil {
+			fmt.Println("error rebuilding,", err)
+			os.Exit(1)
+		}
+		fmt.Println("rebuild started")
+	},
+}
+
+// ctlForceCmd represents the ctl force command
+var ctlForceCmd = &cobra.Command{
+	Use:   "force <node-id>...",
+	Short: "Rebuild the nodes and their dependents",
+	Args:  cobra.MinimumNArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		c := dialCtl(cmd)
+		for _, id := range args {
+			err := c.Force(id)
+			if err != nil {
+				fmt.Println("error forcing", id+",", err)
+				os.Exit(1)
+			}
+		}
+		fmt.Println("rebuild started")
+	},
+}
+
+// ctlNodesCmd represents the ctl nodes command
+var ctlNodesCmd = &cobra.Command{
+	Use:   "nodes",
+	Short: "List the nodes with their states",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		nodes, err := dialCtl(cmd).Nodes()
+		if err != nil {
+			fmt.Println("error listing nodes,", err)
+			os.Exit(1)
+		}
+
+		for _, n := range nodes {
+			fmt.Printf("%-8s %s\n", n.State, n.ID)
+		}
+	},
+}
+
+// ctlStatusCmd represents the ctl status command
+var ctlStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the session state and the last error",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := dialCtl(cmd).Status()
+		if err != nil {
+			fmt.Println("error getting status,", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("building:", s.Building)
+		fmt.Println("paused:  ", s.Paused)
+		if s.LastError != "" {
+			fmt.Println("last error:", s.LastError)
+		}
+	},
+}
+
+// ctlPauseCmd represents the ctl pause command
+var ctlPauseCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Stop rebuilding on changes until resumed",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		err := dialCtl(cmd).Pause()
+		if err != nil {
+			fmt.Println("error pausing,", err)
+			os.Exit(1)
+		}
+		fmt.Println("paused")
+	},
+}
+
+// ctlResumeCmd represents the ctl resume command
+var ctlResumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Rebuild on changes again, including the changes made while paused",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		err := dialCtl(cmd).Resume()
+		if err != nil {
+			fmt.Println("error resuming,", err)
+			os.Exit(1)
+		}
+		fmt.Println("resumed")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ctlCmd)
+	ctlCmd.AddCommand(ctlRebuildCmd)
+	ctlCmd.AddCommand(ctlForceCmd)
+	ctlCmd.AddCommand(ctlNodesCmd)
+	ctlCmd.AddCommand(ctlStatusCmd)
+	ctlCmd.AddCommand(ctlPauseCmd)
+	ctlCmd.AddCommand(ctlResumeCmd)
+
+	ctlCmd.PersistentFlags().String("meta", ".meta", "The meta state directory")
+}
+
+func dialCtl(cmd *cobra.Command) *ctl.Client {
+	metaDir, _ := cmd.Flags().GetString("meta")
+
+	c, err := ctl.Dial(socketPath(metaDir))
+	if err != nil {
+		fmt.Println("is meta up running?", err)
+		os.Exit(1)
+	}
+	return c
+}
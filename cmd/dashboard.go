@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/oligoden/meta/entity/state"
+	"github.com/oligoden/meta/refmap"
+	"github.com/oligoden/meta/tui"
+)
+
+// startDashboard shows the dashboard on the terminal for the session.
+// The log is moved to the log pane and exec output to the output pane.
+// The returned function restores the terminal.
+func startDashboard(title string, s *session, stopSignal chan os.Signal) (func(), error) {
+	d, err := tui.New(os.Stdin, os.Stdout, title)
+	if err != nil {
+		return nil, err
+	}
+
+	restore := console.redirect(d.Log())
+	s.ctx = context.WithValue(s.ctx, refmap.ContextKey("stdout"), d.Output())
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			refreshDashboard(d, s)
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			case a := <-d.Actions:
+				dashboardAction(a, s, stopSignal)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		restore()
+		d.Close()
+	}, nil
+}
+
+// refreshDashboard shows the node states recorded by the refmap, as the
+// nodes themselves are changed by a running rebuild.
+func refreshDashboard(d *tui.Dashboard, s *session) {
+	nodes := []tui.Node{}
+	for id, st := range s.b.rm.States() {
+		nodes = append(nodes, tui.Node{
+			ID:    id,
+			State: state.Name(st),
+		})
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID < nodes[j].ID
+	})
+	links := s.b.rm.Links()
+	running, _ := s.b.running.Load().(string)
+
+	var building, paused bool
+	var duration time.Duration
+	lastErr := ""
+	s.do(func() error {
+		building = s.cancel != nil
+		paused = s.paused
+		duration = s.duration
+		if s.lastErr != nil {
+			lastErr = s.lastErr.Error()
+		}
+		return nil
+	})
+
+	d.Update(func(v *tui.View) {
+		v.Nodes = nodes
+		v.Links = links
+		v.Running = running
+		v.Building = building
+		v.Paused = paused
+		v.Duration = duration
+		v.Error = lastErr
+	})
+}
+
+func dashboardAction(a tui.Action, s *session, stopSignal chan os.Signal) {
+	var err error
+	switch a.Kind {
+	case tui.Quit:
+		select {
+		case stopSignal <- os.Interrupt:
+		default:
+		}
+	case tui.Force:
+		if a.ID != "" {
+			err = s.Force(a.ID)
+		}
+	case tui.Rebuild:
+		err = s.Rebuild()
+	case tui.Pause:
+		status, _ := s.Status()
+		if status.Paused {
+			err = s.Resume()
+		} else {
+			err = s.Pause()
+		}
+	}
+	if err != nil {
+		refmap.Logger(s.ctx).Error("error running action", "action", a.Kind, "err", err)
+	}
+}
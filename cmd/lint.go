@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/oligoden/meta/entity"
+	"github.com/oligoden/meta/refmap"
+	"github.com/spf13/cobra"
+)
+
+// lintCmd represents the lint command
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Check the templates without building",
+	Long: `meta lint processes the config and parses the template of every
+file with the templates of its parent files, without executing or
+writing anything. It reports all templates that are referenced but
+not defined and all fields and vars that are not in the data of the
+file, and exits with status 1 if any problem is found.
+
+See https://oligoden.com/meta for more information.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		// problems are logged by lint, which returns after stopping the
+		// helpers
+		if lint(cmd) != nil {
+			os.Exit(1)
+		}
+	},
+}
+
+// lint checks the templates of all files.
+func lint(cmd *cobra.Command) error {
+	ctx, rm, stop, err := loadProject(cmd)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	logger := refmap.Logger(ctx)
+
+	files := []*entity.File{}
+	for _, ref := range rm.Nodes() {
+		if f, ok := ref.(*entity.File); ok {
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Identifier() < files[j].Identifier()
+	})
+
+	problems := 0
+	for _, f := range files {
+		for _, err := range f.Lint(rm, ctx) {
+			logger.Error("template problem", "node", f.Identifier(), "err", err)
+			problems++
+		}
+	}
+	logger.Log(ctx, levelSummary, "linted", "files", len(files), "problems", problems)
+	if problems > 0 {
+		return fmt.Errorf("%d template problems", problems)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+
+	addProjectFlags(lintCmd)
+}
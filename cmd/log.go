@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oligoden/meta/profile"
+	"github.com/oligoden/meta/refmap"
+	"github.com/spf13/cobra"
+)
+
+// levelSummary is the level of the build summary, which is also logged
+// in quiet mode.
+const levelSummary = slog.LevelError + 4
+
+var levelNames = map[slog.Level]string{
+	refmap.LevelTrace:  "TRACE",
+	refmap.LevelDetail: "DETAIL",
+	levelSummary:       "SUMMARY",
+}
+
+// addLogFlags adds the flags of the logger.
+func addLogFlags(cmd *cobra.Command) {
+	cmd.Flags().IntP("verbose", "v", 0, "Set verbosity to 1, 2 or 3")
+	cmd.Flags().BoolP("quiet", "q", false, "Only log errors and the summary")
+	cmd.Flags().String("log-format", "text", "The log format, text or json")
+}
+
+// newLogger returns the logger set up by the log flags. The logger is
+// also made the default logger for the packages logging without a
+// context.
+func newLogger(cmd *cobra.Command) (*slog.Logger, error) {
+	verbose, _ := cmd.Flags().GetInt("verbose")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	format, _ := cmd.Flags().GetString("log-format")
+
+	level := slog.LevelInfo
+	switch {
+	case quiet:
+		level = slog.LevelError
+	case verbose >= 3:
+		level = refmap.LevelTrace
+	case verbose == 2:
+		level = refmap.LevelDetail
+	case verbose == 1:
+		level = slog.LevelDebug
+	}
+
+	opts := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return a
+			}
+			if a.Key == slog.LevelKey {
+				if name, ok := levelNames[a.Value.Any().(slog.Level)]; ok {
+					a.Value = slog.StringValue(name)
+				}
+			}
+			// the time is left out on terminals
+			if a.Key == slog.TimeKey && format == "text" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}
+
+	var logger *slog.Logger
+	switch format {
+	case "text":
+		logger = slog.New(slog.NewTextHandler(console, opts))
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(console, opts))
+	default:
+		return nil, fmt.Errorf("unknown log format %s", format)
+	}
+	slog.SetDefault(logger)
+	return logger, nil
+}
+
+// withLogger adds the logger to the context, with the writer for the
+// output of execs. The output is logged line by line in the json format
+// and dropped in quiet mode.
+func withLogger(ctx context.Context, cmd *cobra.Command, logger *slog.Logger) context.Context {
+	ctx = context.WithValue(ctx, refmap.ContextKey("logger"), logger)
+
+	format, _ := cmd.Flags().GetString("log-format")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	switch {
+	case quiet:
+		ctx = context.WithValue(ctx, refmap.ContextKey("stdout"), io.Discard)
+	case format == "json":
+		ctx = context.WithValue(ctx, refmap.ContextKey("stdout"), &logWriter{logger: logger})
+	default:
+		ctx = context.WithValue(ctx, refmap.ContextKey("stdout"), console)
+	}
+	return ctx
+}
+
+// console is the writer of the logger and of the output of execs. It
+// writes to the standard output, unless the dashboard redirected it.
+var console = &consoleWriter{w: os.Stdout}
+
+type consoleWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (c *consoleWriter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.w.Write(p)
+}
+
+// redirect writes to the writer until the returned function restores
+// the previous writer.
+func (c *consoleWriter) redirect(w io.Writer) func() {
+	c.mu.Lock()
+	prev := c.w
+	c.w = w
+	c.mu.Unlock()
+
+	return func() {
+		c.mu.Lock()
+		c.w = prev
+		c.mu.Unlock()
+	}
+}
+
+// logWriter logs every line written to it. It is written to by the
+// execs and the rebuilds at the same time.
+type logWriter struct {
+	mu     sync.Mutex
+	logger *slog.Logger
+	buf    []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.logger.Info("output", "line", string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// phase runs a phase of the build and logs its duration.
+func phase(ctx context.Context, name string, f func() error) error {
+	start := time.Now()
+	err := f()
+	refmap.Logger(ctx).Debug("phase finished", "phase", name, "duration", time.Since(start))
+	return err
+}
+
+// logSlowest logs the n slowest nodes of the profile with the time spent
+// per phase.
+func logSlowest(ctx context.Context, prof *profile.Profile, n int) {
+	for i, node := range prof.Slowest(n) {
+		phases := []any{}
+		for _, p := range []string{profile.Process, profile.Perform, profile.Parse, profile.Execute, profile.Filter, profile.Copy, profile.Write, profile.Exec} {
+			if d, ok := node.Phases[p]; ok {
+				phases = append(phases, slog.Duration(p, d))
+			}
+		}
+		refmap.Logger(ctx).Log(ctx, levelSummary, "slow node", "rank", i+1, "node", node.ID, "duration", node.Duration, slog.Group("phases", phases...))
+	}
+}
+
+// perform performs the node of the run and logs the result with the node
+// output. The upstream node that triggered the run is added to the
+// context under the "upstream" key. Errors are logged unless the context
+// was cancelled. It returns the duration of the node.
+func perform(ctx context.Context, rm refmap.CauseGrapher, run refmap.Run) (time.Duration, error) {
+	ref := run.Ref
+	logger := refmap.Logger(ctx).With("node", ref.Identifier(), "phase", "perform")
+	if run.Upstream != "" {
+		logger = logger.With("upstream", run.Upstream)
+		ctx = context.WithValue(ctx, refmap.ContextKey("upstream"), run.Upstream)
+	}
+	logger.Log(ctx, refmap.LevelDetail, "performing node", "cause", strings.Join(rm.Cause(ref.Identifier()), " <- "))
+
+	start := time.Now()
+	err := ref.Perform(rm, ctx)
+	duration := time.Since(start)
+	prof, _ := ctx.Value(refmap.ContextKey("profile")).(*profile.Profile)
+	prof.Add(ref.Identifier(), profile.Perform, start)
+
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Error("error performing node", "duration", duration, "err", err, "output", ref.Output())
+		}
+		return duration, err
+	}
+
+	if ref.Output() != "" {
+		logger.Info("performed node", "duration", duration, "output", ref.Output())
+		return duration, nil
+	}
+	logger.Debug("performed node", "duration", duration)
+	return duration, nil
+}
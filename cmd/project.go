@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oligoden/meta/entity"
+	"github.com/oligoden/meta/helper"
+	"github.com/oligoden/meta/refmap"
+	"github.com/spf13/cobra"
+)
+
+// addProjectFlags adds the flags read by loadProject.
+func addProjectFlags(cmd *cobra.Command) {
+	cmd.Flags().String("metafile", "meta.json", "The meta file")
+	cmd.Flags().String("dest", "", "The base destination directory")
+	cmd.Flags().String("orig", "", "The base origin directory")
+	cmd.Flags().String("meta", ".meta", "The meta state directory")
+	addLogFlags(cmd)
+}
+
+// loadProject loads and processes the project and evaluates the graph
+// for the commands that read the graph without building. Errors are
+// logged and returned after stopping the helpers. The returned context
+// holds the logger and the locations, and the returned function stops
+// the helpers.
+func loadProject(cmd *cobra.Command) (context.Context, *refmap.Store, func(), error) {
+	logger, err := newLogger(cmd)
+	if err != nil {
+		fmt.Println(err)
+		return nil, nil, nil, err
+	}
+
+	metaFileName, _ := cmd.Flags().GetString("metafile")
+	_, err = os.Stat(metaFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Error("project config not found", "file", metaFileName)
+		return nil, nil, nil, err
+	}
+
+	metaOverrideFileName := strings.TrimSuffix(metaFileName, filepath.Ext(metaFileName)) + ".override" + filepath.Ext(metaFileName)
+	e := entity.NewProject()
+	err = loadConfig(e, metaFileName, metaOverrideFileName)
+	if err != nil {
+		logger.Error("error loading project config", "err", err)
+		return nil, nil, nil, err
+	}
+
+	origLocation, _ := cmd.Flags().GetString("orig")
+	if origLocation == "" {
+		origLocation = e.OrigLocation
+	}
+	destLocation, _ := cmd.Flags().GetString("dest")
+	if destLocation == "" {
+		destLocation = e.DestLocation
+	}
+	metaDir, _ := cmd.Flags().GetString("meta")
+
+	ctx := context.WithValue(context.Background(), refmap.ContextKey("orig"), origLocation)
+	ctx = context.WithValue(ctx, refmap.ContextKey("dest"), destLocation)
+	ctx = context.WithValue(ctx, refmap.ContextKey("meta"), metaDir)
+	ctx = withLogger(ctx, cmd, logger)
+
+	// the helpers are started while processing the project
+	helpers := helper.NewSet()
+	ctx = context.WithValue(ctx, refmap.ContextKey("helpers"), helpers)
+
+	rm := refmap.Start()
+	err = e.Process(&entity.ProjectBranch{}, rm, ctx)
+	if err != nil {
+		logger.Error("error processing project", "phase", "process", "err", err)
+		helpers.Close()
+		return nil, nil, nil, err
+	}
+	err = rm.Evaluate()
+	if err != nil {
+		logger.Error("error evaluating graph", "phase", "evaluate", "err", err)
+		helpers.Close()
+		return nil, nil, nil, err
+	}
+
+	return ctx, rm, func() { helpers.Close() }, nil
+}
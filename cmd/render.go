@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oligoden/meta/entity"
+	"github.com/oligoden/meta/refmap"
+	"github.com/spf13/cobra"
+)
+
+// renderCmd represents the render command
+var renderCmd = &cobra.Command{
+	Use:   "render <source-path>",
+	Short: "Render a single file to stdout",
+	Long: `meta render processes the config and prints the file with the
+template executed, the parent templates added and the filters
+applied, without writing anything. The source path is relative to
+the current directory or to the origin directory.
+
+Use --context to print the data passed to the template as JSON.
+
+See https://oligoden.com/meta for more information.`,
+	Args: cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		// failures are logged by render, which returns after stopping
+		// the helpers
+		if render(cmd, args[0]) != nil {
+			os.Exit(1)
+		}
+	},
+}
+
+// render prints the file at the source path.
+func render(cmd *cobra.Command, path string) error {
+	ctx, rm, stop, err := loadProject(cmd)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	logger := refmap.Logger(ctx)
+	origLocation := ctx.Value(refmap.ContextKey("orig")).(string)
+
+	id := "file:" + sourcePath(origLocation, path)
+	file := findFile(rm, id)
+	if file == nil {
+		logger.Error("file not found in the config", "node", id)
+		return fmt.Errorf("file %s not found", id)
+	}
+
+	showContext, _ := cmd.Flags().GetBool("context")
+	if showContext {
+		content, err := json.MarshalIndent(file.Branch, "", "  ")
+		if err != nil {
+			logger.Error("error encoding context", "err", err)
+			return err
+		}
+		fmt.Println(string(content))
+		return nil
+	}
+
+	out, err := file.Render(rm, ctx)
+	if err != nil {
+		logger.Error("error rendering", "node", id, "err", err)
+		return err
+	}
+	out.WriteTo(os.Stdout)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(renderCmd)
+
+	addProjectFlags(renderCmd)
+	renderCmd.Flags().Bool("context", false, "Print the template data as JSON instead")
+}
+
+// sourcePath returns the path of the source file relative to the origin
+// directory. Paths outside the origin directory are taken as relative
+// to it.
+func sourcePath(origLocation, path string) string {
+	rel, err := filepath.Rel(origLocation, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Clean(path)
+	}
+	return rel
+}
+
+func findFile(rm *refmap.Store, id string) *entity.File {
+	for _, ref := range rm.Nodes() {
+		if f, ok := ref.(*entity.File); ok && ref.Identifier() == id {
+			return f
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/oligoden/meta/entity"
+	"github.com/oligoden/meta/entity/state"
+	"github.com/oligoden/meta/profile"
+	"github.com/oligoden/meta/refmap"
+	"github.com/oligoden/meta/report"
+)
+
+// newRecord returns the report record of a performed node.
+func newRecord(ctx context.Context, ref refmap.Actioner, duration time.Duration, err error) report.Record {
+	rec := report.Record{
+		ID:       ref.Identifier(),
+		Result:   report.Built,
+		Before:   state.Name(ref.State()),
+		Duration: duration,
+	}
+	if ref.State() == state.Remove {
+		rec.Result = report.Removed
+	}
+	if err != nil {
+		rec.Result = report.Failed
+		rec.Error = err.Error()
+	}
+
+	if f, ok := ref.(entity.Destinationer); ok {
+		rec.Output = f.Destination(ctx)
+	}
+	if e, ok := ref.(entity.ExitCoder); ok {
+		exitCode := e.ExitCode()
+		rec.ExitCode = &exitCode
+	}
+	return rec
+}
+
+// nodeStates returns the state names of the nodes.
+func nodeStates(rm *refmap.Store) map[string]string {
+	states := map[string]string{}
+	for _, ref := range rm.Nodes() {
+		states[ref.Identifier()] = state.Name(ref.State())
+	}
+	return states
+}
+
+// finishReport sets the states of the performed nodes after the build
+// and adds the nodes that were not performed as skipped. The phase times
+// are taken from the profile.
+func finishReport(r *report.Report, before, after map[string]string, prof *profile.Profile) {
+	performed := map[string]bool{}
+	for i, rec := range r.Nodes {
+		performed[rec.ID] = true
+		r.Nodes[i].After = after[rec.ID]
+		if _, ok := after[rec.ID]; !ok {
+			r.Nodes[i].After = report.Removed
+		}
+	}
+
+	for id, s := range before {
+		if performed[id] {
+			continue
+		}
+		rec := report.Record{
+			ID:     id,
+			Result: report.Skipped,
+			Before: s,
+			After:  after[id],
+		}
+		if _, ok := after[id]; !ok {
+			rec.After = report.Removed
+		}
+		r.Add(rec)
+	}
+
+	phases := map[string]map[string]time.Duration{}
+	for _, n := range prof.Nodes() {
+		phases[n.ID] = n.Phases
+	}
+	for i, rec := range r.Nodes {
+		r.Nodes[i].Phases = phases[rec.ID]
+	}
+}
+
+// writeTrace writes the profile as a Chrome trace-event file.
+func writeTrace(prof *profile.Profile, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating profile, %w", err)
+	}
+
+	err = prof.WriteTrace(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/oligoden/meta/ctl"
+	"github.com/oligoden/meta/entity/state"
+	"github.com/oligoden/meta/refmap"
+	"github.com/oligoden/meta/serve"
+	"github.com/oligoden/meta/watch"
+)
+
+// session holds the state of the meta up loop. All fields are owned by
+// the loop goroutine, the control API runs its calls on the loop.
+type session struct {
+	b         *builder
+	ctx       context.Context
+	debouncer *watch.Debouncer
+	server    *serve.Server
+
+	// pending are the changes for the next rebuild and building the
+	// changes of the running rebuild
+	pending  *changes
+	building *changes
+
+	// the running rebuild is cancelled when new changes arrive
+	// and a follow-up rebuild is queued for when it returned
+	cancel context.CancelFunc
+	queued bool
+	built  chan error
+
+	paused  bool
+	lastErr error
+
+	// started is the start of the running rebuild and duration
+	// the duration of the last rebuild that was not cancelled
+	started  time.Time
+	duration time.Duration
+
+	ops     chan func()
+	stopped chan struct{}
+}
+
+func newSession(ctx context.Context, b *builder, debouncer *watch.Debouncer) *session {
+	return &session{
+		b:         b,
+		ctx:       ctx,
+		debouncer: debouncer,
+		pending:   newChanges(),
+		built:     make(chan error),
+		ops:       make(chan func()),
+		stopped:   make(chan struct{}),
+	}
+}
+
+// flush adds the debounced events to the pending changes and rebuilds
+// unless watching is paused.
+func (s *session) flush() {
+	inputs := s.b.rm.Inputs()
+	for _, event := range s.debouncer.Flush() {
+		relevant, err := s.pending.add(event, inputs, s.b.origLocation)
+		if err != nil {
+			refmap.Logger(s.ctx).Error("error finding relative path", "err", err)
+		}
+		if relevant {
+			refmap.Logger(s.ctx).Info("fs event", "op", event.Op.String(), "path", event.Path)
+		}
+	}
+	if !s.paused {
+		s.kick()
+	}
+}
+
+// kick starts a rebuild for the pending changes, or cancels the running
+// rebuild and queues a follow-up.
+func (s *session) kick() {
+	if s.pending.empty() {
+		return
+	}
+	if s.cancel != nil {
+		refmap.Logger(s.ctx).Info("changes detected, cancelling rebuild")
+		s.cancel()
+		s.queued = true
+		return
+	}
+	s.rebuild()
+}
+
+func (s *session) rebuild() {
+	c := s.pending
+	s.pending = c.next()
+	s.building = c
+	s.started = time.Now()
+
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(s.ctx)
+	go func() {
+		s.built <- s.b.rebuild(ctx, c)
+	}()
+}
+
+// finished handles the result of a rebuild.
+func (s *session) finished(err error) {
+	s.cancel()
+	s.cancel = nil
+	if !errors.Is(err, context.Canceled) {
+		s.duration = time.Since(s.started)
+	}
+
+	logger := refmap.Logger(s.ctx)
+	if err != nil {
+		// the changes are retried with the next change
+		s.pending.merge(s.building)
+		if errors.Is(err, context.Canceled) {
+			logger.Info("rebuild cancelled")
+		} else {
+			s.lastErr = err
+			logger.Log(s.ctx, levelSummary, "rebuild failed, waiting for changes to retry", "nodes", s.b.performed, "duration", s.duration, "err", err)
+		}
+	} else {
+		logger.Log(s.ctx, levelSummary, "rebuilt", "nodes", s.b.performed, "duration", s.duration)
+		s.lastErr = nil
+		if !s.queued {
+			s.server.Reload()
+		}
+		s.b.probe.write()
+	}
+	s.building = nil
+
+	if s.queued {
+		s.queued = false
+		s.rebuild()
+	}
+}
+
+// stop cancels the running rebuild and waits for it to return.
+func (s *session) stop() {
+	if s.cancel != nil {
+		s.cancel()
+		<-s.built
+	}
+	close(s.stopped)
+}
+
+// do runs the function on the loop.
+func (s *session) do(f func() error) error {
+	errc := make(chan error, 1)
+	select {
+	case s.ops <- func() { errc <- f() }:
+		return <-errc
+	case <-s.stopped:
+		return errors.New("meta up is stopping")
+	}
+}
+
+// Rebuild reloads the config and rebuilds all nodes, also while paused.
+func (s *session) Rebuild() error {
+	return s.do(func() error {
+		s.pending.metafile = true
+		s.pending.all = true
+		s.kick()
+		return nil
+	})
+}
+
+// Force rebuilds the node and its dependents, also while paused.
+func (s *session) Force(id string) error {
+	if _, found := s.b.rm.States()[id]; !found {
+		return fmt.Errorf("node %s not found", id)
+	}
+	return s.do(func() error {
+		s.pending.updated[id] = "forced"
+		s.kick()
+		return nil
+	})
+}
+
+// Nodes returns the nodes with the states recorded by the refmap. The
+// nodes themselves are not read, as a running rebuild changes them.
+func (s *session) Nodes() ([]ctl.Node, error) {
+	nodes := []ctl.Node{}
+	for id, st := range s.b.rm.States() {
+		nodes = append(nodes, ctl.Node{
+			ID:    id,
+			State: state.Name(st),
+		})
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID < nodes[j].ID
+	})
+	return nodes, nil
+}
+
+func (s *session) Status() (ctl.Status, error) {
+	status := ctl.Status{}
+	err := s.do(func() error {
+		status.Building = s.cancel != nil
+		status.Paused = s.paused
+		if s.lastErr != nil {
+			status.LastError = s.lastErr.Error()
+		}
+		return nil
+	})
+	return status, err
+}
+
+// Pause stops rebuilding on changes. The changes are still collected
+// and built when resumed.
+func (s *session) Pause() error {
+	return s.do(func() error {
+		if !s.paused {
+			refmap.Logger(s.ctx).Info("watching paused")
+		}
+		s.paused = true
+		return nil
+	})
+}
+
+func (s *session) Resume() error {
+	return s.do(func() error {
+		if s.paused {
+			refmap.Logger(s.ctx).Info("watching resumed")
+		}
+		s.paused = false
+		s.kick()
+		return nil
+	})
+}
+
+// socketPath returns the path of the control socket in the meta directory.
+func socketPath(metaDir string) string {
+	return filepath.Join(metaDir, ctl.SocketName)
+}
@@ -4,17 +4,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/fsnotify/fsnotify"
+	"github.com/oligoden/meta/ctl"
 	"github.com/oligoden/meta/entity"
+	"github.com/oligoden/meta/helper"
+	"github.com/oligoden/meta/ignore"
 	"github.com/oligoden/meta/refmap"
+	"github.com/oligoden/meta/serve"
+	"github.com/oligoden/meta/watch"
 	"github.com/spf13/cobra"
 )
 
@@ -29,259 +35,757 @@ dependent nodes if an update is detected.
 See https://oligoden.com/meta for more information.`,
 
 	Run: func(cmd *cobra.Command, args []string) {
-		metaFileName, err := cmd.Flags().GetString("metafile")
-		if err != nil {
-			fmt.Println("error getting config filename flag,", err)
+		// failures are logged by up, which returns after its deferred
+		// cleanup so that the exit status can report them
+		if up(cmd) != nil {
 			os.Exit(1)
 		}
+	},
+}
 
-		verboseValue, _ := cmd.Flags().GetInt("verbose")
-		if verboseValue > 0 {
-			fmt.Println("verbosity level", verboseValue)
+// up builds the project and rebuilds it on changes until stopped.
+func up(cmd *cobra.Command) error {
+	logger, err := newLogger(cmd)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	metaFileName, err := cmd.Flags().GetString("metafile")
+	if err != nil {
+		logger.Error("error getting config filename flag", "err", err)
+		return err
+	}
+
+	_, err = os.Stat(metaFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Error("project config not found", "file", metaFileName)
+		return err
+	}
+
+	logger.Info("loading metafile")
+	metaOverrideFileName := strings.TrimSuffix(metaFileName, filepath.Ext(metaFileName)) + ".override" + filepath.Ext(metaFileName)
+	e := entity.NewProject()
+	err = loadConfig(e, metaFileName, metaOverrideFileName)
+	if err != nil {
+		logger.Error("error loading project config", "err", err)
+		return err
+	}
+
+	origLocation, err := cmd.Flags().GetString("orig")
+	if err != nil {
+		logger.Error("error getting origin flag", "err", err)
+		return err
+	}
+
+	if origLocation == "" {
+		origLocation = e.OrigLocation
+	}
+
+	destLocation, err := cmd.Flags().GetString("dest")
+	if err != nil {
+		logger.Error("error getting destination flag", "err", err)
+		return err
+	}
+
+	if destLocation == "" {
+		destLocation = e.DestLocation
+	}
+
+	ctx := context.WithValue(context.Background(), refmap.ContextKey("orig"), origLocation)
+	ctx = context.WithValue(ctx, refmap.ContextKey("dest"), destLocation)
+	ctx = withLogger(ctx, cmd, logger)
+	metaDir, _ := cmd.Flags().GetString("meta")
+	ctx = context.WithValue(ctx, refmap.ContextKey("meta"), metaDir)
+
+	// the helpers are started while processing the project
+	helpers := helper.NewSet()
+	defer helpers.Close()
+	ctx = context.WithValue(ctx, refmap.ContextKey("helpers"), helpers)
+
+	// the configuration is processed and graph build
+	logger.Info("processing configuration")
+
+	skip := skipPaths(origLocation, destLocation, metaDir)
+	ignored := ignore.New(origLocation)
+	fileWatcher, probe, err := newWatcher(cmd, e, func(path string, isDir bool) bool {
+		return skip(path, isDir) || ignored.Ignored(path, isDir)
+	})
+	if err != nil {
+		logger.Error("error starting file watcher", "err", err)
+		return err
+	}
+	defer fileWatcher.Close()
+	ctx = context.WithValue(ctx, refmap.ContextKey("ignore"), ignored)
+
+	rm := refmap.Start()
+	b := &builder{
+		e:                    e,
+		rm:                   rm,
+		metaFileName:         metaFileName,
+		metaOverrideFileName: metaOverrideFileName,
+		origLocation:         origLocation,
+		metaDir:              metaDir,
+		fileWatcher:          fileWatcher,
+		ignored:              ignored,
+	}
+	if probe {
+		b.probe = newProber(metaDir)
+	}
+
+	start := time.Now()
+	err = phase(ctx, "process", func() error {
+		err := e.Process(&entity.ProjectBranch{}, rm, ctx)
+		if err != nil {
+			return err
 		}
-
-		_, err = os.Stat(metaFileName)
-		if errors.Is(err, os.ErrNotExist) {
-			fmt.Printf("project config \"%s\" not found\n", metaFileName)
-			os.Exit(0)
+		return b.addConfigInputs(ctx)
+	})
+	if err != nil {
+		logger.Error("error processing project", "phase", "process", "err", err)
+		return err
+	}
+	err = phase(ctx, "evaluate", rm.Evaluate)
+	if err != nil {
+		logger.Error("error evaluating graph", "phase", "evaluate", "err", err)
+		return err
+	}
+	rm.Assess()
+	rm.Output()
+
+	err = fileWatcher.Sync(b.watchDirs()...)
+	if err != nil {
+		logger.Error("error watching source directories", "err", err)
+		return err
+	}
+
+	logger.Info("building project")
+	performed, failed := 0, 0
+	phase(ctx, "perform", func() error {
+		for _, run := range rm.ChangedRuns() {
+			performed++
+			if _, err := perform(ctx, rm, run); err != nil {
+				failed++
+			}
 		}
-
-		fmt.Println("loading metafile")
-		f, err := os.Open(metaFileName)
+		return nil
+	})
+	err = saveCauses(ctx, metaDir, rm.Causes())
+	if err != nil {
+		logger.Error("error saving causes", "err", err)
+	}
+	rm.Finish()
+	logger.Log(ctx, levelSummary, "READY", "nodes", performed, "failed", failed, "duration", time.Since(start))
+
+	var server *serve.Server
+	addr, _ := cmd.Flags().GetString("serve")
+	if addr != "" {
+		server = serve.New(destLocation)
+		err = server.Start(addr)
 		if err != nil {
-			log.Fatalln(err)
-			return
+			logger.Error("error starting server", "err", err)
+			return err
 		}
-
-		e := entity.NewProject()
-		err = e.Load(f)
+		defer server.Close()
+		logger.Info("serving", "dir", destLocation, "addr", addr)
+	}
+
+	debounce, err := cmd.Flags().GetDuration("debounce")
+	if err != nil {
+		logger.Error("error getting debounce flag", "err", err)
+		return err
+	}
+
+	stopSignal := make(chan os.Signal, 1)
+	signal.Notify(stopSignal, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stopSignal)
+	ctx = context.WithValue(ctx, refmap.ContextKey("force"), true)
+	done := make(chan bool)
+
+	// any changes to files are watched
+	logger.Info("watching for changes")
+	fileEvents, fileErrors := fileWatcher.Channels()
+
+	s := newSession(ctx, b, watch.NewDebouncer(debounce))
+	s.server = server
+	b.probe.write()
+
+	err = os.MkdirAll(metaDir, os.ModePerm)
+	if err != nil {
+		logger.Error("error creating meta directory", "err", err)
+		return err
+	}
+	control, err := ctl.Serve(socketPath(metaDir), s)
+	if err != nil {
+		logger.Error("error starting control API", "err", err)
+		return err
+	}
+	defer control.Close()
+
+	useTUI, _ := cmd.Flags().GetBool("tui")
+	if useTUI {
+		stop, err := startDashboard("meta up "+e.Name, s, stopSignal)
 		if err != nil {
-			log.Fatalln("error loading config", metaFileName, "->", err)
+			logger.Error("error starting dashboard", "err", err)
+			return err
 		}
-		f.Close()
-
-		metaOverrideFileName := strings.TrimSuffix(metaFileName, filepath.Ext(metaFileName)) + ".override" + filepath.Ext(metaFileName)
-		f, err = os.Open(metaOverrideFileName)
-		if err != nil {
-			if !strings.Contains(err.Error(), "no such file or directory") {
-				log.Fatalln(err)
-				return
+		defer stop()
+	}
+
+	go func() {
+		run := true
+		for run {
+			select {
+			case <-stopSignal:
+				logger.Info("stopping")
+				s.stop()
+				run = false
+			case event := <-fileEvents:
+				if b.probe.received(event) {
+					continue
+				}
+				s.debouncer.Add(event)
+			case err := <-fileErrors:
+				logger.Error("error on file watcher", "err", err)
+			case <-b.probe.C():
+				b.probe.expired(logger)
+			case <-s.debouncer.C():
+				s.flush()
+			case err := <-s.built:
+				s.finished(err)
+			case op := <-s.ops:
+				op()
 			}
-		} else {
-			err = e.Load(f)
-			if err != nil {
-				log.Fatalln("error loading file", metaFileName, err)
-				return
+		}
+		done <- true
+	}()
+	<-done
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(upCmd)
+
+	upCmd.Flags().String("metafile", "meta.json", "The meta file")
+	upCmd.Flags().String("dest", "", "The base destination directory")
+	upCmd.Flags().String("orig", "", "The base origin directory")
+	upCmd.Flags().BoolP("force", "f", false, "Force rebuilding of existing files")
+	addLogFlags(upCmd)
+	upCmd.Flags().Duration("debounce", 400*time.Millisecond, "Wait for changes to settle before rebuilding")
+	upCmd.Flags().String("meta", ".meta", "The meta state directory")
+	upCmd.Flags().Bool("tui", false, "Show a dashboard with the node states and exec output")
+	upCmd.Flags().String("serve", "", "Serve the destination directory on the address, like :8080, and reload browsers after rebuilds")
+	upCmd.Flags().Bool("poll", false, "Poll the sources for changes instead of using notifications")
+	upCmd.Flags().Duration("poll-interval", time.Second, "The interval between polls")
+	upCmd.Flags().Bool("poll-hash", false, "Also compare the contents of files when polling")
+}
+
+// newWatcher starts the file watcher selected by the flags or the watch
+// configuration of the project. It also reports whether notifications
+// should be probed, which is when the polling watcher is not used.
+func newWatcher(cmd *cobra.Command, e *entity.Project, skip func(string, bool) bool) (watch.Watcher, bool, error) {
+	poll, _ := cmd.Flags().GetBool("poll")
+	interval, _ := cmd.Flags().GetDuration("poll-interval")
+	hash, _ := cmd.Flags().GetBool("poll-hash")
+
+	if !cmd.Flags().Changed("poll") {
+		poll = e.Watch.Poll
+	}
+	if !cmd.Flags().Changed("poll-interval") && e.Watch.Interval > 0 {
+		interval = time.Duration(e.Watch.Interval) * time.Millisecond
+	}
+	if !cmd.Flags().Changed("poll-hash") {
+		hash = e.Watch.Hash
+	}
+
+	if poll {
+		slog.Info("polling for changes", "interval", interval)
+		return watch.NewPoller(interval, hash, skip), false, nil
+	}
+
+	w, err := watch.New(skip)
+	if err != nil {
+		return nil, false, err
+	}
+	return w, true, nil
+}
+
+// prober checks that the file system delivers notifications, which is
+// not the case on many network mounts. A probe file is written to the
+// meta directory at startup and after rebuilds, until an event for it
+// arrives or none arrived in time. It is used on the loop goroutine.
+type prober struct {
+	path    string
+	timeout <-chan time.Time
+	done    bool
+}
+
+// newProber creates the directory of the probe file, so that it is
+// watched before the first probe is written.
+func newProber(metaDir string) *prober {
+	p := &prober{path: filepath.Join(metaDir, "probe", "watch")}
+	p.done = os.MkdirAll(filepath.Dir(p.path), os.ModePerm) != nil
+	return p
+}
+
+// write writes and removes the probe file, unless notifications are
+// confirmed or a probe is waiting for its event.
+func (p *prober) write() {
+	if p == nil || p.done || p.timeout != nil {
+		return
+	}
+
+	if os.WriteFile(p.path, nil, 0644) != nil {
+		p.done = true
+		return
+	}
+	os.Remove(p.path)
+	p.timeout = time.After(2 * time.Second)
+}
+
+// received reports whether the event is for the probe file, which
+// confirms that notifications are delivered.
+func (p *prober) received(event watch.Event) bool {
+	if p == nil || event.Path != p.path {
+		return false
+	}
+	p.done = true
+	p.timeout = nil
+	return true
+}
+
+// expired suggests polling when no event arrived for the probe file.
+func (p *prober) expired(logger *slog.Logger) {
+	p.done = true
+	p.timeout = nil
+	logger.Warn("no file events received after writing the probe file, the file system may not support notifications, try meta up --poll", "file", p.path)
+}
+
+// C returns the channel on which the probe expires.
+func (p *prober) C() <-chan time.Time {
+	if p == nil {
+		return nil
+	}
+	return p.timeout
+}
+
+// changes are the changes collected by the watcher for a rebuild.
+type changes struct {
+	metafile  bool
+	ignore    bool
+	structure bool
+	// all nodes are rebuilt
+	all bool
+	// updated are the nodes to update with the cause of the change
+	updated map[string]string
+
+	// nodes of which the source file was removed or renamed
+	missing map[string]string
+}
+
+func newChanges() *changes {
+	return &changes{
+		updated: map[string]string{},
+		missing: map[string]string{},
+	}
+}
+
+// next returns the changes for the following rebuild. Missing files stay
+// missing until they are created again.
+func (c *changes) next() *changes {
+	n := newChanges()
+	for id, cause := range c.missing {
+		n.missing[id] = cause
+	}
+	return n
+}
+
+// merge adds the changes of a failed rebuild that are not superseded.
+func (c *changes) merge(o *changes) {
+	c.metafile = c.metafile || o.metafile
+	c.ignore = c.ignore || o.ignore
+	c.structure = c.structure || o.structure
+	c.all = c.all || o.all
+	for id, cause := range o.updated {
+		if _, missing := c.missing[id]; !missing {
+			if _, found := c.updated[id]; !found {
+				c.updated[id] = cause
 			}
-			f.Close()
 		}
+	}
+	for id, cause := range o.missing {
+		if _, updated := c.updated[id]; !updated {
+			c.missing[id] = cause
+		}
+	}
+}
+
+func (c *changes) empty() bool {
+	return !c.metafile && !c.ignore && !c.all && len(c.updated) == 0 && len(c.missing) == 0
+}
+
+// add records the change to a path. The nodes that registered the path as
+// an input are updated, where a change to an input of the project or a
+// directory, such as the meta file or an imported config, reloads the
+// config. Other paths in the origin directory are source files. It
+// reports whether the path is an input or a source.
+func (c *changes) add(event watch.Event, inputs map[string][]string, origLocation string) (bool, error) {
+	if event.Op&(watch.Create|watch.Write|watch.Remove|watch.Rename) == 0 {
+		return false, nil
+	}
+
+	relPath, err := filepath.Rel(origLocation, event.Path)
+	if err != nil {
+		return false, err
+	}
+	id := "file:" + relPath
+	cause := "fs " + strings.ToLower(event.Op.String())
+
+	keys := inputs[filepath.Clean(event.Path)]
+	for _, key := range keys {
+		switch {
+		case key == id:
+		case strings.HasPrefix(key, "prj:") || strings.HasPrefix(key, "dir:"):
+			c.metafile = true
+		default:
+			c.updated[key] = cause + " " + event.Path
+		}
+	}
+
+	if relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return len(keys) > 0, nil
+	}
+	if filepath.Base(relPath) == ignore.Filename {
+		// the ignore rules changed, re-expand the file
+		// sets and update the watches after processing
+		c.ignore = true
+		return true, nil
+	}
+
+	if event.Op&(watch.Remove|watch.Rename) != 0 {
+		c.missing[id] = cause
+		delete(c.updated, id)
+	} else if event.Op&(watch.Create|watch.Write) != 0 {
+		delete(c.missing, id)
+		c.updated[id] = cause
+	}
+	return true, nil
+}
+
+// builder rebuilds the project on changes.
+type builder struct {
+	e                    *entity.Project
+	rm                   *refmap.Store
+	metaFileName         string
+	metaOverrideFileName string
+	origLocation         string
+	metaDir              string
+	fileWatcher          watch.Watcher
+	ignored              *ignore.Matcher
+
+	// probe is set when notifications are probed
+	probe *prober
+
+	// stale is set while the config on disk fails to load
+	stale bool
+
+	// running is the identifier of the node being performed and
+	// performed the number of nodes performed by the last rebuild
+	running   atomic.Value
+	performed int
+}
 
-		origLocation, err := cmd.Flags().GetString("orig")
+// rebuild processes the changes and performs the changed nodes. It
+// stops between nodes when the context is cancelled or a node fails,
+// leaving the nodes that were not built flagged for the next rebuild.
+func (b *builder) rebuild(ctx context.Context, c *changes) error {
+	logger := refmap.Logger(ctx)
+	b.performed = 0
+
+	// a config that failed to load or process is retried on every
+	// change while building with the last good config
+	var loaded *entity.Project
+	if c.metafile || b.stale {
+		e, err := b.reload()
 		if err != nil {
-			fmt.Println("error getting origin flag", err)
-			return
+			logger.Error("error reloading project config, building with the last good config", "err", err)
 		}
+		b.stale = err != nil
+		loaded = e
+	}
+	if c.ignore {
+		b.ignored.Reset()
+	}
+
+	// files that are not nodes yet change the structure of the graph
+	structureChange := loaded != nil || c.ignore || c.structure
+	for id := range c.updated {
+		if !hasNode(b.rm, id) {
+			structureChange = true
+		}
+	}
 
-		if origLocation == "" {
-			origLocation = e.OrigLocation
+	err := phase(ctx, "process", func() error {
+		if loaded != nil {
+			err := b.swap(ctx, loaded)
+			if err == nil {
+				return nil
+			}
+			logger.Error("error processing project config, building with the last good config", "err", err)
+			b.stale = true
 		}
 
-		destLocation, err := cmd.Flags().GetString("dest")
+		err := b.e.Process(&entity.ProjectBranch{}, b.rm, ctx)
 		if err != nil {
-			fmt.Println("error getting destination flag", err)
-			return
+			return err
+		}
+		return b.addConfigInputs(ctx)
+	})
+	if err != nil {
+		c.structure = true
+		return fmt.Errorf("error processing project %w", err)
+	}
+
+	if c.all {
+		for _, n := range b.rm.Nodes() {
+			b.rm.SetUpdate(n.Identifier(), "rebuild requested")
 		}
+	}
+	for id, cause := range c.updated {
+		b.rm.SetUpdate(id, cause)
+	}
+	for id, cause := range c.missing {
+		if b.rm.SetRemove(id, cause) == nil {
+			structureChange = true
+		}
+	}
 
-		if destLocation == "" {
-			destLocation = e.DestLocation
+	if structureChange {
+		err = phase(ctx, "evaluate", b.rm.Evaluate)
+		if err != nil {
+			c.structure = true
+			return fmt.Errorf("error evaluating graph %w", err)
 		}
+	}
+
+	b.rm.Propagate()
+	b.rm.Assess()
+	b.rm.Output()
+
+	logger.Info("rebuilding")
+	defer b.running.Store("")
+	err = phase(ctx, "perform", func() error {
+		for _, run := range b.rm.ChangedRuns() {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 
-		ctx := context.WithValue(context.Background(), refmap.ContextKey("orig"), origLocation)
-		ctx = context.WithValue(ctx, refmap.ContextKey("dest"), destLocation)
-		ctx = context.WithValue(ctx, refmap.ContextKey("verbose"), verboseValue)
+			b.running.Store(run.Ref.Identifier())
+			b.performed++
+			_, err := perform(ctx, b.rm, run)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return fmt.Errorf("error performing actions on %s %w", run.Ref.Identifier(), err)
+			}
+		}
+		return nil
+	})
+
+	// the causes of nodes that were not built are kept for the next
+	// rebuild and saved again
+	if saveErr := saveCauses(ctx, b.metaDir, b.rm.Causes()); saveErr != nil {
+		logger.Error("error saving causes", "err", saveErr)
+	}
+	if err != nil {
+		return err
+	}
+	b.rm.Finish()
+
+	err = b.fileWatcher.Sync(b.watchDirs()...)
+	if err != nil {
+		logger.Error("error watching source directories", "err", err)
+	}
+	return nil
+}
 
-		// the configuration is processed and graph build
-		fmt.Println("processing configuration")
+// watchDirs returns the directories to watch, with the directory of the
+// probe file.
+func (b *builder) watchDirs() []watch.Dir {
+	dirs := watchDirs(b.e, b.origLocation, b.rm.Inputs())
+	if b.probe != nil {
+		dirs = append(dirs, watch.Dir{Path: filepath.Dir(b.probe.path)})
+	}
+	return dirs
+}
 
-		fileWatcher, err := fsnotify.NewWatcher()
+// addConfigInputs registers the meta file and its override file, whether
+// it exists or not, as inputs of the project.
+func (b *builder) addConfigInputs(ctx context.Context) error {
+	for _, name := range []string{b.metaFileName, b.metaOverrideFileName} {
+		err := b.rm.AddInput(ctx, b.e.Identifier(), name)
 		if err != nil {
-			fmt.Println("error starting file watcher", err)
-			return
+			return fmt.Errorf("adding input %s, %w", name, err)
 		}
-		defer fileWatcher.Close()
+	}
+	return nil
+}
 
-		metafileWatcher, err := fsnotify.NewWatcher()
-		if err != nil {
-			fmt.Println("error starting meta file watcher", err)
-			return
+// reload loads the meta file and its override file again into a new
+// project, so that entries removed from the config are not kept.
+func (b *builder) reload() (*entity.Project, error) {
+	e := entity.NewProject()
+	err := loadConfig(e, b.metaFileName, b.metaOverrideFileName)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// swap processes the reloaded project and replaces the project with it.
+// The nodes of removed entries are not processed and set for removal by
+// Assess. When processing fails, the nodes only added by the reloaded
+// project are removed again, so that the last good project is built
+// with its own graph.
+func (b *builder) swap(ctx context.Context, e *entity.Project) error {
+	before := map[string]bool{}
+	for _, n := range b.rm.Nodes() {
+		before[n.Identifier()] = true
+	}
+
+	e.Follow(b.e)
+	err := e.Process(&entity.ProjectBranch{}, b.rm, ctx)
+	if err == nil {
+		b.e = e
+		return b.addConfigInputs(ctx)
+	}
+
+	b.e.Follow(e)
+	for _, n := range b.rm.Nodes() {
+		if !before[n.Identifier()] {
+			b.rm.SetRemove(n.Identifier(), "config failed to process")
 		}
-		defer metafileWatcher.Close()
-		metafileWatcher.Add(metaFileName)
+	}
+	return err
+}
 
-		ctx = context.WithValue(ctx, refmap.ContextKey("watcher"), metafileWatcher)
+func loadConfig(e *entity.Project, metaFileName, metaOverrideFileName string) error {
+	f, err := os.Open(metaFileName)
+	if err != nil {
+		return fmt.Errorf("error opening meta file %w", err)
+	}
+
+	err = e.Load(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("error loading file %s %w", metaFileName, err)
+	}
+
+	f, err = os.Open(metaOverrideFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error opening meta override file %w", err)
+	}
+
+	err = e.Load(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("error loading meta override file %s %w", metaOverrideFileName, err)
+	}
+	return nil
+}
 
-		rm := refmap.Start()
-		err = e.Process(&entity.ProjectBranch{}, rm, ctx)
-		if err != nil {
-			fmt.Println("error processing project", err)
-			return
-		}
-		err = rm.Evaluate()
-		if err != nil {
-			fmt.Println("error evaluating graph", err)
-			return
+func hasNode(rm refmap.Grapher, id string) bool {
+	for _, n := range rm.Nodes("", id) {
+		if n.Identifier() == id {
+			return true
 		}
-		rm.Assess()
-		rm.Output()
-
-		fmt.Println("building project...")
-		for _, ref := range rm.ChangedRefs() {
-			if strings.HasPrefix(ref.Identifier(), "file:") {
-				filename := filepath.Join(origLocation, ref.Identifier()[5:])
-				fileWatcher.Add(filename)
-			}
+	}
+	return false
+}
 
-			err = ref.Perform(rm, ctx)
-			if err != nil {
-				fmt.Println("error performing actions on", ref.Identifier(), err)
-				fmt.Println(ref.Output())
-			}
+// watchDirs returns the source directories of the project. The origin
+// directory itself is watched for the top level files and the source
+// directories of all the configured directories are watched recursively,
+// so that file sets are expanded again when files appear or disappear.
+// The directories of inputs outside of these, like the meta file, are
+// watched as well.
+func watchDirs(e *entity.Project, origLocation string, inputs map[string][]string) []watch.Dir {
+	// file sets at the top level select files below the origin
+	dirs := []watch.Dir{{Path: origLocation, Recursive: len(e.Include) > 0}}
+	for _, dir := range e.SourceDirs() {
+		dirs = append(dirs, watch.Dir{
+			Path:      filepath.Join(origLocation, dir),
+			Recursive: true,
+		})
+	}
+
+	paths := make([]string, 0, len(inputs))
+	for path := range inputs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if !watched(dir, dirs) {
+			dirs = append(dirs, watch.Dir{Path: dir})
+		}
+	}
+	return dirs
+}
 
-			if ref.Output() != "" {
-				fmt.Println(ref.Output())
-			}
+// watched reports whether the directory is one of the directories or
+// below a recursive one.
+func watched(dir string, dirs []watch.Dir) bool {
+	for _, d := range dirs {
+		rel, err := filepath.Rel(filepath.Clean(d.Path), dir)
+		if err != nil {
+			continue
 		}
-		rm.Finish()
-		fmt.Println("READY")
-
-		stopSignal := make(chan os.Signal, 1)
-		signal.Notify(stopSignal, os.Interrupt, syscall.SIGTERM)
-		ctx = context.WithValue(ctx, refmap.ContextKey("force"), true)
-		done := make(chan bool)
-
-		// any changes to files are watched
-		fmt.Println("watching for changes")
-
-		go func() {
-			run := true
-			metafileChange := false
-			fileChange := false
-
-			for run {
-				select {
-				case <-stopSignal:
-					fmt.Println()
-					fmt.Println("stopping")
-					run = false
-				case event := <-metafileWatcher.Events:
-					fmt.Println("fs event", event.Op, event.Name)
-					if event.Op&fsnotify.Write == fsnotify.Write ||
-						event.Op&fsnotify.Chmod == fsnotify.Chmod {
-						metafileChange = true
-					}
-				case err := <-metafileWatcher.Errors:
-					fmt.Println("error on meta file watcher", err)
-					run = false
-				case event := <-fileWatcher.Events:
-					fmt.Println("fs event", event.Op, event.Name)
-					if event.Op&fsnotify.Write == fsnotify.Write ||
-						event.Op&fsnotify.Chmod == fsnotify.Chmod {
-						relPath, err := filepath.Rel(origLocation, event.Name)
-						if err != nil {
-							fmt.Println("error finding relative path", err)
-							continue
-						}
-						rm.SetUpdate("file:" + relPath)
-						fileChange = true
-					}
-				case err := <-fileWatcher.Errors:
-					fmt.Println("error on meta file watcher", err)
-					run = false
-				case <-time.After(400 * time.Millisecond):
-					if !(metafileChange || fileChange) {
-						continue
-					}
-					if metafileChange {
-						f, err := os.Open(metaFileName)
-						if err != nil {
-							fmt.Println("error opening meta file", err)
-							run = false
-							break
-						}
-
-						err = e.Load(f)
-						if err != nil {
-							fmt.Println("error loading file", metaFileName, err)
-							run = false
-							break
-						}
-						f.Close()
-
-						f, err = os.Open(metaOverrideFileName)
-						if err != nil {
-							if !strings.Contains(err.Error(), "no such file or directory") {
-								fmt.Println("error opening meta override file", err)
-								return
-							}
-						} else {
-							err = e.Load(f)
-							if err != nil {
-								fmt.Println("error loading meta override file", metaOverrideFileName, err)
-								return
-							}
-							f.Close()
-						}
-
-					}
-
-					err = e.Process(&entity.ProjectBranch{}, rm, ctx)
-					if err != nil {
-						fmt.Println("error processing project", err)
-						run = false
-						break
-					}
-
-					if metafileChange {
-						rm.Evaluate()
-					}
-
-					rm.Propagate()
-					rm.Assess()
-					rm.Output()
-
-					fmt.Println("rebuilding")
-					for _, ref := range rm.ChangedRefs() {
-						err = ref.Perform(rm, ctx)
-						if err != nil {
-							fmt.Println("error performing actions on", ref.Identifier(), err)
-							fmt.Println(ref.Output())
-							metafileChange = false
-							fileChange = false
-							break
-						}
-
-						if ref.Output() != "" {
-							fmt.Println(ref.Output())
-						}
-					}
-
-					rm.Finish()
-					metafileChange = false
-					fileChange = false
-				}
-			}
-			done <- true
-		}()
-		<-done
-	},
+		if rel == "." || d.Recursive && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
 }
 
-func init() {
-	rootCmd.AddCommand(upCmd)
+// skipPaths skips the destination directory, the meta state directory
+// and the graph output so that built files do not trigger rebuilds. The
+// destination is not skipped when the sources are located inside it. The
+// directory of the probe file in the meta directory is watched.
+func skipPaths(origLocation, destLocation, metaDir string) func(string, bool) bool {
+	orig, _ := filepath.Abs(origLocation)
+	dest, _ := filepath.Abs(destLocation)
+	meta, _ := filepath.Abs(metaDir)
+	probe := filepath.Join(meta, "probe")
+	graph, _ := filepath.Abs("output.gv")
+	if within(orig, dest) {
+		dest = ""
+	}
+
+	return func(path string, isDir bool) bool {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return false
+		}
+		if abs == graph {
+			return true
+		}
+		if within(abs, meta) && !within(abs, probe) {
+			return true
+		}
+		if dest == "" {
+			return false
+		}
+		return within(abs, dest)
+	}
+}
 
-	upCmd.Flags().String("metafile", "meta.json", "The meta file")
-	upCmd.Flags().String("dest", "", "The base destination directory")
-	upCmd.Flags().String("orig", "", "The base origin directory")
-	upCmd.Flags().BoolP("force", "f", false, "Force rebuilding of existing files")
-	upCmd.Flags().IntP("verbose", "v", 0, "Set verbosity to 1, 2 or 3")
+// within reports whether the clean absolute path is the directory or
+// below it.
+func within(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
 }
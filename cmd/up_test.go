@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkipPaths(t *testing.T) {
+	assert := assert.New(t)
+
+	// the meta directory set with --meta inside the origin
+	orig := t.TempDir()
+	skip := skipPaths(orig, filepath.Join(orig, "out"), filepath.Join(orig, "state"))
+
+	assert.True(skip(filepath.Join(orig, "state"), true))
+	assert.True(skip(filepath.Join(orig, "state", "exec", "gen.log"), false))
+	assert.True(skip(filepath.Join(orig, "state", "cache.json"), false))
+	assert.True(skip(filepath.Join(orig, "out", "a.go"), false))
+
+	// the probe file is watched
+	assert.False(skip(filepath.Join(orig, "state", "probe"), true))
+	assert.False(skip(filepath.Join(orig, "state", "probe", "watch"), false))
+
+	// sources named like the default meta directory are watched
+	assert.False(skip(filepath.Join(orig, ".meta"), true))
+	assert.False(skip(filepath.Join(orig, "src", ".meta", "a.go"), false))
+	assert.False(skip(filepath.Join(orig, "stateful"), true))
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oligoden/meta/refmap"
+	"github.com/spf13/cobra"
+)
+
+// whyFileName is the file in the meta directory with the causes of the
+// last rebuild of every node.
+const whyFileName = "why.json"
+
+// whyCmd represents the why command
+var whyCmd = &cobra.Command{
+	Use:   "why <node-id>",
+	Short: "Explain why a node was last rebuilt",
+	Long: `meta why prints the cause chain of the last rebuild of a node by
+meta build or meta up, from the node up the graph to the change
+that caused it, such as
+
+  exec:gen <- file:api/model.go <- fs write
+
+See https://oligoden.com/meta for more information.`,
+	Args: cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := newLogger(cmd)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		metaDir, _ := cmd.Flags().GetString("meta")
+
+		causes, err := loadCauses(metaDir)
+		if err != nil {
+			logger.Error("error reading causes", "err", err)
+			os.Exit(1)
+		}
+
+		c, found := causes[args[0]]
+		if !found {
+			logger.Error("no rebuild recorded", "node", args[0])
+			os.Exit(1)
+		}
+		fmt.Println(strings.Join(c.Chain, " <- "))
+		fmt.Println("rebuilt at", c.Time.Format(time.RFC3339))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(whyCmd)
+
+	whyCmd.Flags().String("meta", ".meta", "The meta state directory")
+	addLogFlags(whyCmd)
+}
+
+// cause is the cause chain of the last rebuild of a node.
+type cause struct {
+	Chain []string  `json:"chain"`
+	Time  time.Time `json:"time"`
+}
+
+func loadCauses(metaDir string) (map[string]cause, error) {
+	causes := map[string]cause{}
+
+	content, err := os.ReadFile(filepath.Join(metaDir, whyFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return causes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(content, &causes)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s, %w", whyFileName, err)
+	}
+	return causes, nil
+}
+
+// saveCauses adds the cause chains of the nodes rebuilt now to the causes
+// in the meta directory. A damaged file is replaced with a warning.
+func saveCauses(ctx context.Context, metaDir string, chains map[string][]string) error {
+	if len(chains) == 0 {
+		return nil
+	}
+
+	causes, err := loadCauses(metaDir)
+	if err != nil {
+		refmap.Logger(ctx).Warn("replacing causes that can not be read, the recorded causes are lost", "file", filepath.Join(metaDir, whyFileName), "err", err)
+		causes = map[string]cause{}
+	}
+
+	now := time.Now()
+	for id, chain := range chains {
+		causes[id] = cause{Chain: chain, Time: now}
+	}
+
+	content, err := json.MarshalIndent(causes, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(metaDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(metaDir, whyFileName), content, 0644)
+}
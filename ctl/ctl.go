@@ -0,0 +1,220 @@
+// Package ctl is the control API of a running meta up session. The
+// session serves HTTP with JSON bodies on a Unix socket in the meta
+// directory, which the client uses to trigger rebuilds, force nodes,
+// query node states and pause watching.
+package ctl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// SocketName is the name of the socket in the meta directory.
+const SocketName = "up.sock"
+
+// Controller is implemented by the meta up session.
+type Controller interface {
+	Rebuild() error
+	Force(id string) error
+	Nodes() ([]Node, error)
+	Status() (Status, error)
+	Pause() error
+	Resume() error
+}
+
+// Node is a node of the graph with its state.
+type Node struct {
+	ID    string `json:"id"`
+	State string `json:"state"`
+}
+
+// Status is the state of the session. LastError is the error of the last
+// rebuild and empty when it succeeded.
+type Status struct {
+	Building  bool   `json:"building"`
+	Paused    bool   `json:"paused"`
+	LastError string `json:"last_error"`
+}
+
+type response struct {
+	Error string `json:"error,omitempty"`
+}
+
+type Server struct {
+	path string
+	srv  *http.Server
+}
+
+// Serve listens on the socket and serves the controller in the
+// background. A socket left behind by a session that is not running
+// anymore is replaced.
+func Serve(path string, c Controller) (*Server, error) {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		if _, derr := net.DialTimeout("unix", path, time.Second); derr == nil {
+			return nil, fmt.Errorf("meta up is already running on %s", path)
+		}
+		os.Remove(path)
+		l, err = net.Listen("unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("listening on %s, %w", path, err)
+		}
+	}
+
+	s := &Server{
+		path: path,
+		srv:  &http.Server{Handler: Handler(c)},
+	}
+	go s.srv.Serve(l)
+	return s, nil
+}
+
+// Close stops the server and removes the socket.
+func (s *Server) Close() error {
+	err := s.srv.Close()
+	os.Remove(s.path)
+	return err
+}
+
+// Handler returns the HTTP API of the controller.
+func Handler(c Controller) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rebuild", post(func(r *http.Request) (interface{}, error) {
+		return response{}, c.Rebuild()
+	}))
+	mux.HandleFunc("/force", post(func(r *http.Request) (interface{}, error) {
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			return nil, errors.New("no node id given")
+		}
+		return response{}, c.Force(id)
+	}))
+	mux.HandleFunc("/pause", post(func(r *http.Request) (interface{}, error) {
+		return response{}, c.Pause()
+	}))
+	mux.HandleFunc("/resume", post(func(r *http.Request) (interface{}, error) {
+		return response{}, c.Resume()
+	}))
+	mux.HandleFunc("/nodes", get(func(r *http.Request) (interface{}, error) {
+		return c.Nodes()
+	}))
+	mux.HandleFunc("/status", get(func(r *http.Request) (interface{}, error) {
+		return c.Status()
+	}))
+	return mux
+}
+
+func post(h func(*http.Request) (interface{}, error)) http.HandlerFunc {
+	return method(http.MethodPost, h)
+}
+
+func get(h func(*http.Request) (interface{}, error)) http.HandlerFunc {
+	return method(http.MethodGet, h)
+}
+
+func method(m string, h func(*http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != m {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(response{Error: "method not allowed"})
+			return
+		}
+
+		v, err := h(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response{Error: err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(v)
+	}
+}
+
+// Client calls the API of a running session.
+type Client struct {
+	http *http.Client
+}
+
+// Dial returns a client for the socket. It fails when no session is
+// listening on the socket.
+func Dial(path string) (*Client, error) {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to meta up, %w", err)
+	}
+	conn.Close()
+
+	return &Client{
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", path)
+				},
+			},
+		},
+	}, nil
+}
+
+func (c *Client) Rebuild() error {
+	return c.call(http.MethodPost, "/rebuild", nil)
+}
+
+func (c *Client) Force(id string) error {
+	return c.call(http.MethodPost, "/force?id="+url.QueryEscape(id), nil)
+}
+
+func (c *Client) Pause() error {
+	return c.call(http.MethodPost, "/pause", nil)
+}
+
+func (c *Client) Resume() error {
+	return c.call(http.MethodPost, "/resume", nil)
+}
+
+func (c *Client) Nodes() ([]Node, error) {
+	nodes := []Node{}
+	err := c.call(http.MethodGet, "/nodes", &nodes)
+	return nodes, err
+}
+
+func (c *Client) Status() (Status, error) {
+	s := Status{}
+	err := c.call(http.MethodGet, "/status", &s)
+	return s, err
+}
+
+func (c *Client) call(method, path string, v interface{}) error {
+	req, err := http.NewRequest(method, "http://meta"+path, nil)
+	if err != nil {
+		return err
+	}
+
+	rsp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		e := response{}
+		err = json.NewDecoder(rsp.Body).Decode(&e)
+		if err != nil || e.Error == "" {
+			return fmt.Errorf("unexpected response %s", rsp.Status)
+		}
+		return errors.New(e.Error)
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(rsp.Body).Decode(v)
+}
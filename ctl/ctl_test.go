@@ -0,0 +1,102 @@
+package ctl_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oligoden/meta/ctl"
+	"github.com/stretchr/testify/assert"
+)
+
+type controllerStub struct {
+	forced  []string
+	paused  bool
+	rebuilt int
+}
+
+func (c *controllerStub) Rebuild() error {
+	c.rebuilt++
+	return nil
+}
+
+func (c *controllerStub) Force(id string) error {
+	if id == "file:none" {
+		return errors.New("node file:none not found")
+	}
+	c.forced = append(c.forced, id)
+	return nil
+}
+
+func (c *controllerStub) Nodes() ([]ctl.Node, error) {
+	return []ctl.Node{{ID: "prj:a", State: "stable"}}, nil
+}
+
+func (c *controllerStub) Status() (ctl.Status, error) {
+	return ctl.Status{Paused: c.paused, LastError: "failed"}, nil
+}
+
+func (c *controllerStub) Pause() error {
+	c.paused = true
+	return nil
+}
+
+func (c *controllerStub) Resume() error {
+	c.paused = false
+	return nil
+}
+
+func TestControl(t *testing.T) {
+	assert := assert.New(t)
+
+	if err := os.MkdirAll("testing", 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll("testing")
+	socket := filepath.Join("testing", ctl.SocketName)
+
+	_, err := ctl.Dial(socket)
+	assert.Error(err)
+
+	// a socket left behind is replaced
+	if err := os.WriteFile(socket, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &controllerStub{}
+	s, err := ctl.Serve(socket, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ctl.Serve(socket, c)
+	assert.Error(err)
+
+	client, err := ctl.Dial(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(client.Rebuild())
+	assert.Equal(1, c.rebuilt)
+
+	assert.NoError(client.Force("file:a/b c.ext"))
+	assert.Equal([]string{"file:a/b c.ext"}, c.forced)
+	assert.EqualError(client.Force("file:none"), "node file:none not found")
+
+	assert.NoError(client.Pause())
+	status, err := client.Status()
+	assert.NoError(err)
+	assert.Equal(ctl.Status{Paused: true, LastError: "failed"}, status)
+	assert.NoError(client.Resume())
+	assert.False(c.paused)
+
+	nodes, err := client.Nodes()
+	assert.NoError(err)
+	assert.Equal([]ctl.Node{{ID: "prj:a", State: "stable"}}, nodes)
+
+	assert.NoError(s.Close())
+	_, err = os.Stat(socket)
+	assert.True(os.IsNotExist(err))
+}
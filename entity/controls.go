@@ -2,43 +2,29 @@ package entity
 
 import (
 	"fmt"
-	"regexp"
+
+	"github.com/oligoden/meta/refmap"
 )
 
 type Mapping struct {
-	Start      Regexp `json:"start"`
-	End        Regexp `json:"end"`
+	Start      Pattern `json:"start"`
+	End        Pattern `json:"end"`
 	StartSet   string
 	EndSet     string
-	Recurrence int `json:"recurrence"`
-}
-
-type Regexp struct {
-	regexp.Regexp
+	Recurrence uint `json:"recurrence"`
 }
 
-func (r *Regexp) UnmarshalText(text []byte) error {
-	search := string(text)
-	search = fmt.Sprintf("^%s$", search)
-	re := regexp.MustCompile(`\.`)
-	search = re.ReplaceAllString(search, `\.`)
-	re = regexp.MustCompile(`\*`)
-	search = re.ReplaceAllString(search, `.*`)
-
-	rr, err := Compile(search)
-	if err != nil {
-		return err
+// recurrence returns the recurrence of the mapped edges. By default the
+// end node runs once per build cycle, while refmap.RecurUpstream runs it
+// once for every changed start node.
+func (m Mapping) recurrence() (uint, error) {
+	switch m.Recurrence {
+	case refmap.RecurDefault, refmap.RecurBatch:
+		return refmap.RecurBatch, nil
+	case refmap.RecurUpstream:
+		return refmap.RecurUpstream, nil
 	}
-	*r = *rr
-	return nil
-}
-
-func Compile(expr string) (*Regexp, error) {
-	re, err := regexp.Compile(expr)
-	if err != nil {
-		return nil, err
-	}
-	return &Regexp{*re}, nil
+	return refmap.RecurDefault, fmt.Errorf("unknown recurrence %d", m.Recurrence)
 }
 
 const (
@@ -49,8 +35,9 @@ const (
 
 type filters map[string]map[string]string
 
+// ControlMappings returns the mappings of the entity and its parents.
 func (e Basic) ControlMappings() []*Mapping {
-	return e.Mpns
+	return e.controls
 }
 
 func (b Basic) ContainsFilter(filter string) bool {
@@ -67,3 +54,23 @@ func (e Basic) Options() string {
 func (e Basic) Filters() filters {
 	return e.Flts
 }
+
+func (e Basic) Delimiters() []string {
+	return e.Dlms
+}
+
+func (e Basic) Engines() map[string]string {
+	return e.Engs
+}
+
+// validDelims checks that the delimiters are empty or a left and right
+// delimiter.
+func validDelims(delims []string) error {
+	if len(delims) == 0 {
+		return nil
+	}
+	if len(delims) != 2 || delims[0] == "" || delims[1] == "" {
+		return fmt.Errorf("delims must be a left and a right delimiter")
+	}
+	return nil
+}
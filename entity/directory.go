@@ -63,17 +63,16 @@ func (e *Directory) Process(bb BranchBuilder, rm refmap.Mutator, ctx context.Con
 		}
 	}
 
-	hash := ""
-	nodes := rm.Nodes("", e.Identifier())
-	if len(nodes) > 0 {
-		hash = nodes[0].Hash()
-	}
+	hash, flagged := previous(rm, e.Identifier())
 	e.Detect = state.New(hash)
 
 	err := e.ProcessState()
 	if err != nil {
 		return err
 	}
+	if flagged {
+		e.FlagState()
+	}
 
 	err = e.Basic.Process(bb, rm, ctx)
 	if err != nil {
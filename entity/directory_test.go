@@ -155,6 +155,15 @@ func TestDirProcessExt(t *testing.T) {
 	if exp != got {
 		t.Errorf(`expected "%s", got "%s"`, exp, got)
 	}
+
+	// processing again does not add the mappings of the parent again
+	err = e.Process(&entity.Branch{}, rm, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dir.Mpns) != 1 || len(dir.ControlMappings()) != 4 {
+		t.Errorf("expected 1 mapping and 4 control mappings, got %d and %d", len(dir.Mpns), len(dir.ControlMappings()))
+	}
 }
 
 func TestDirPerform(t *testing.T) {
@@ -1173,6 +1182,10 @@ func (rm refMapStub) MapRef(ctx context.Context, a, b string, o ...uint) error {
 	return nil
 }
 
+func (rm refMapStub) AddInput(ctx context.Context, k, p string) error {
+	return nil
+}
+
 func (rm refMapStub) ParentFiles(f string) []string {
 	return []string{}
 }
@@ -0,0 +1,182 @@
+package entity
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Source is the template of a file with the templates of its parent
+// files, as given to an engine.
+type Source struct {
+	Name    string
+	Content string
+	// Delims are the left and right delimiters, or empty for the
+	// default delimiters.
+	Delims []string
+	// Parents are the templates of the parent files, without parents
+	// or functions of their own.
+	Parents []Source
+	Funcs   template.FuncMap
+}
+
+// Engine parses the templates of files.
+type Engine interface {
+	Parse(Source) (Executor, error)
+}
+
+// Executor executes a parsed template on the data of a file.
+type Executor interface {
+	Execute(io.Writer, interface{}) error
+}
+
+// The engines of Meta, chosen with the engine= option or by extension.
+const (
+	EngineText        = "text"
+	EngineHTML        = "html"
+	EnginePassthrough = "passthrough"
+)
+
+var (
+	enginesMu sync.Mutex
+	engines   = map[string]Engine{
+		EngineText:        textEngine{},
+		EngineHTML:        htmlEngine{},
+		EnginePassthrough: passthroughEngine{},
+	}
+)
+
+// RegisterEngine adds an engine that files can choose by name, replacing
+// the engine with the same name. Like RegisterFuncs it is meant for
+// builds of Meta and is called before running the commands.
+func RegisterEngine(name string, e Engine) {
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+
+	engines[name] = e
+}
+
+func lookupEngine(name string) (Engine, bool) {
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+
+	e, ok := engines[name]
+	return e, ok
+}
+
+// delims returns the delimiters of the source, empty for the defaults.
+func delims(src Source) (string, string) {
+	if len(src.Delims) != 2 {
+		return "", ""
+	}
+	return src.Delims[0], src.Delims[1]
+}
+
+// templates is the part of the API shared by text/template and
+// html/template that parses the templates of a source.
+type templates[T any] interface {
+	New(name string) T
+	Option(opt ...string) T
+	Delims(left, right string) T
+	Parse(text string) (T, error)
+	Lookup(name string) T
+}
+
+// parseSource parses the source and the templates of its parents into
+// the new template named after the source, which has the functions of
+// the source, and returns the template of the source.
+func parseSource[T templates[T]](tmpl T, src Source) (T, error) {
+	_, err := tmpl.Option("missingkey=error").Delims(delims(src)).Parse(src.Content)
+	if err != nil {
+		return tmpl, err
+	}
+
+	for _, p := range src.Parents {
+		// new templates take the delimiters of the template
+		left, right := delims(p)
+		_, err = tmpl.New(p.Name).Option("missingkey=error").Delims(left, right).Parse(p.Content)
+		if err != nil {
+			return tmpl, err
+		}
+	}
+	return tmpl.Lookup(src.Name), nil
+}
+
+// textEngine parses the templates with text/template.
+type textEngine struct{}
+
+func (textEngine) Parse(src Source) (Executor, error) {
+	return parseText(src)
+}
+
+func parseText(src Source) (*template.Template, error) {
+	tmpl, err := parseSource(template.New(src.Name).Funcs(src.Funcs), src)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// htmlEngine parses the templates with html/template, which escapes the
+// values for the context they are written in.
+type htmlEngine struct{}
+
+func (htmlEngine) Parse(src Source) (Executor, error) {
+	tmpl, err := parseSource(htmltemplate.New(src.Name).Funcs(htmltemplate.FuncMap(src.Funcs)), src)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// passthroughEngine writes the source as is.
+type passthroughEngine struct{}
+
+func (passthroughEngine) Parse(src Source) (Executor, error) {
+	return passthrough(src.Content), nil
+}
+
+type passthrough string
+
+func (p passthrough) Execute(w io.Writer, _ interface{}) error {
+	_, err := io.WriteString(w, string(p))
+	return err
+}
+
+// engine returns the engine of the file, named by its engine= option, or
+// else configured for its extension, or else the text engine. The
+// options of the file follow the options of its parents, so the last
+// engine= option is used.
+func (file *File) engine() (Engine, string, error) {
+	name := ""
+	for _, option := range strings.Split(file.Opts, ",") {
+		if n, ok := strings.CutPrefix(option, "engine="); ok {
+			name = n
+		}
+	}
+	if name != "" {
+		e, ok := lookupEngine(name)
+		if !ok {
+			return nil, "", fmt.Errorf("unknown engine %s", name)
+		}
+		return e, name, nil
+	}
+
+	ext := filepath.Ext(strings.TrimSuffix(file.Name, ".tmpl"))
+	for _, key := range []string{ext, strings.TrimPrefix(ext, ".")} {
+		name, ok := file.engines[key]
+		if !ok || key == "" {
+			continue
+		}
+		e, ok := lookupEngine(name)
+		if !ok {
+			return nil, "", fmt.Errorf("unknown engine %s for %s files", name, ext)
+		}
+		return e, name, nil
+	}
+	return textEngine{}, EngineText, nil
+}
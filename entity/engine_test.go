@@ -0,0 +1,173 @@
+package entity_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/oligoden/meta/entity"
+	"github.com/oligoden/meta/entity/state"
+	"github.com/oligoden/meta/refmap"
+	"github.com/stretchr/testify/assert"
+)
+
+type upperEngine struct{}
+
+func (upperEngine) Parse(src entity.Source) (entity.Executor, error) {
+	return upperEngine{}, nil
+}
+
+func (upperEngine) Execute(w io.Writer, data interface{}) error {
+	_, err := io.WriteString(w, "UPPER")
+	return err
+}
+
+func TestEngines(t *testing.T) {
+	assert := assert.New(t)
+
+	entity.RegisterEngine("upper", upperEngine{})
+
+	if err := os.MkdirAll("testing/chart", 0755); err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll("testing")
+
+	files := map[string]string{
+		"partial.txt":     `{{define "name"}}{{.Vars.name}}{{end}}`,
+		"chart/values.go": `{{ .Values.x }} [[template "name" .]] [[.Vars.name]]`,
+		"page.html":       `<a href="/?q={{.Vars.name}}">{{.Vars.name}}</a>`,
+		"app.vue":         `{{ msg }}`,
+		"app.x":           `{{ msg }}`,
+		"text.html":       `<a>{{.Vars.name}}</a>`,
+	}
+	for name, c := range files {
+		if err := ioutil.WriteFile("testing/"+name, []byte(c), 0644); err != nil {
+			t.Error(err)
+		}
+	}
+
+	f := bytes.NewBufferString(`{
+		"name": "abc",
+		"vars": {"name": "a&b"},
+		"engines": {".vue": "passthrough", "x": "upper"},
+		"mappings": [
+			{"start": "file:partial.txt", "end": "file:chart/values.go"}
+		],
+		"files": {
+			"partial.txt": {},
+			"page.html": {"options": "engine=html"},
+			"text.html": {"options": "html"},
+			"app.vue": {},
+			"app.x": {}
+		},
+		"dirs": {
+			"chart": {
+				"delims": ["[[", "]]"],
+				"files": {"values.go": {}}
+			}
+		}
+	}`)
+
+	e := &entity.Basic{Detect: state.New()}
+	err := e.Load(f)
+	if err != nil {
+		t.Error("loading config")
+	}
+
+	rm := refmap.Start()
+
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, refmap.ContextKey("orig"), "testing")
+	ctx = context.WithValue(ctx, refmap.ContextKey("dest"), "testing/out")
+
+	err = e.Process(&entity.Branch{}, rm, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = rm.Evaluate()
+	if err != nil {
+		t.Error("error evaluating refmap", err)
+	}
+
+	rendered := map[string]string{}
+	for _, ref := range rm.Nodes() {
+		if file, ok := ref.(*entity.File); ok {
+			out, err := file.Render(rm, ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rendered[ref.Identifier()] = out.String()
+			assert.Empty(file.Lint(rm, ctx), ref.Identifier())
+		}
+	}
+	assert.Equal("{{ .Values.x }} a&b a&b", rendered["file:chart/values.go"])
+	assert.Equal(`<a href="/?q=a%26b">a&amp;b</a>`, rendered["file:page.html"])
+	assert.Equal("{{ msg }}", rendered["file:app.vue"])
+	assert.Equal("UPPER", rendered["file:app.x"])
+	// only the engine= option chooses an engine
+	assert.Equal("<a>a&b</a>", rendered["file:text.html"])
+}
+
+func TestEnginesInvalid(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		config string
+		err    string
+	}{
+		{
+			desc:   "delims",
+			config: `{"name": "abc", "files": {"a.txt": {"delims": ["[["]}}}`,
+			err:    "file:a.txt, delims must be a left and a right delimiter",
+		},
+		{
+			desc:   "engine",
+			config: `{"name": "abc", "engines": {".txt": "none"}, "files": {"a.txt": {}}}`,
+			err:    "unknown engine none for .txt files",
+		},
+		{
+			desc:   "engine option",
+			config: `{"name": "abc", "files": {"a.txt": {"options": "engine=none"}}}`,
+			err:    "unknown engine none",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if err := os.MkdirAll("testing", 0755); err != nil {
+				t.Error(err)
+			}
+			defer os.RemoveAll("testing")
+
+			if err := ioutil.WriteFile("testing/a.txt", []byte("a"), 0644); err != nil {
+				t.Error(err)
+			}
+
+			e := &entity.Basic{Detect: state.New()}
+			err := e.Load(strings.NewReader(tC.config))
+			if err != nil {
+				t.Error("loading config")
+			}
+
+			rm := refmap.Start()
+			ctx := context.Background()
+			ctx = context.WithValue(ctx, refmap.ContextKey("orig"), "testing")
+			ctx = context.WithValue(ctx, refmap.ContextKey("dest"), "testing/out")
+
+			err = e.Process(&entity.Branch{}, rm, ctx)
+			if err == nil {
+				rm.Evaluate()
+				for _, ref := range rm.Nodes() {
+					if file, ok := ref.(*entity.File); ok {
+						_, err = file.Render(rm, ctx)
+					}
+				}
+			}
+			assert.EqualError(t, err, tC.err)
+		})
+	}
+}
@@ -11,7 +11,6 @@ import (
 
 	"github.com/oligoden/meta/entity/state"
 	"github.com/oligoden/meta/refmap"
-	"gopkg.in/fsnotify.v1"
 )
 
 type ConfigReader interface {
@@ -22,6 +21,8 @@ type ConfigReader interface {
 	Options() string
 	ContainsFilter(string) bool
 	Filters() filters
+	Delimiters() []string
+	Engines() map[string]string
 	Variables() map[string]string
 	refmap.Actioner
 }
@@ -34,13 +35,19 @@ type Basic struct {
 	Directories     map[string]*Directory `json:"dirs"`
 	Files           map[string]*File      `json:"files"`
 	Execs           map[string]*CLE       `json:"execs"`
+	Include         []*FileSet            `json:"include"`
+	Exclude         []string              `json:"exclude"`
 	Import          bool                  `json:"import"`
 	Opts            string                `json:"options"`
 	Flts            filters               `json:"filters"`
 	Mpns            []*Mapping            `json:"mappings"`
+	Dlms            []string              `json:"delims"`
+	Engs            map[string]string     `json:"engines"`
 	This            ConfigReader          `json:"-"`
 	Parent          ConfigReader          `json:"-"`
 	posibleMappings map[string]Mapping
+	controls        []*Mapping
+	expanded        map[string]*File
 	*state.Detect
 }
 
@@ -107,8 +114,9 @@ func (e *Basic) Process(bb BranchBuilder, rm refmap.Mutator, ctx context.Context
 			return err
 		}
 
-		if metfileWatcher, ok := ctx.Value(refmap.ContextKey("watcher")).(*fsnotify.Watcher); ok {
-			metfileWatcher.Add(metafile)
+		err = rm.AddInput(ctx, e.This.Identifier(), metafile)
+		if err != nil {
+			return fmt.Errorf("adding input %s, %w", metafile, err)
 		}
 
 		if e.Directories == nil {
@@ -147,9 +155,27 @@ func (e *Basic) Process(bb BranchBuilder, rm refmap.Mutator, ctx context.Context
 	}
 
 	mappings := e.Mpns
+	for i, m := range mappings {
+		location := fmt.Sprintf("mappings[%d] in %s", i, e.This.Identifier())
+		err := m.Start.Compile()
+		if err != nil {
+			return fmt.Errorf("%s, start %w", location, err)
+		}
+		err = m.End.Compile()
+		if err != nil {
+			return fmt.Errorf("%s, end %w", location, err)
+		}
+	}
+
+	// the mappings of the parent control the children as well, kept
+	// apart from the configured mappings that are processed again
+	e.controls = append([]*Mapping{}, e.Mpns...)
+
 	options := []string{}
 
 	if e.Parent != nil {
+		e.controls = append(e.controls, e.Parent.ControlMappings()...)
+
 		if e.Parent.Options() != "" {
 			for _, option := range strings.Split(e.Parent.Options(), ",") {
 				if !strings.Contains(e.Opts, option) {
@@ -158,7 +184,18 @@ func (e *Basic) Process(bb BranchBuilder, rm refmap.Mutator, ctx context.Context
 			}
 		}
 
-		e.Mpns = append(e.Mpns, e.Parent.ControlMappings()...)
+		if e.Dlms == nil {
+			e.Dlms = e.Parent.Delimiters()
+		}
+
+		if e.Engs == nil {
+			e.Engs = map[string]string{}
+		}
+		for ext, engine := range e.Parent.Engines() {
+			if _, exist := e.Engs[ext]; !exist {
+				e.Engs[ext] = engine
+			}
+		}
 
 		// for i, filter := range e.Parent.Filters() {
 		// 	if _, exist := e.Controls.Behaviour.Filters[i]; !exist {
@@ -176,6 +213,16 @@ func (e *Basic) Process(bb BranchBuilder, rm refmap.Mutator, ctx context.Context
 	}
 	e.Opts = strings.Join(options, ",")
 
+	err = validDelims(e.Dlms)
+	if err != nil {
+		return fmt.Errorf("%s, %w", e.This.Identifier(), err)
+	}
+
+	err = e.expand(ctx)
+	if err != nil {
+		return err
+	}
+
 	for name := range e.Files {
 		e.Files[name].Name = name
 		e.Files[name].Parent = e.This
@@ -185,6 +232,15 @@ func (e *Basic) Process(bb BranchBuilder, rm refmap.Mutator, ctx context.Context
 		}
 	}
 
+	for name := range e.expanded {
+		e.expanded[name].Name = name
+		e.expanded[name].Parent = e.This
+		err := e.expanded[name].Process(bb, rm, ctx)
+		if err != nil {
+			return err
+		}
+	}
+
 	for name := range e.Directories {
 		e.Directories[name].Name = name
 		e.Directories[name].Parent = e.This
@@ -215,12 +271,20 @@ func (e *Basic) Process(bb BranchBuilder, rm refmap.Mutator, ctx context.Context
 		}
 	}
 
-	for _, m := range mappings {
+	for i, m := range mappings {
+		location := fmt.Sprintf("mappings[%d] in %s", i, e.This.Identifier())
+		ctx := context.WithValue(ctx, refmap.ContextKey("mapping"), location)
+
+		recurrence, err := m.recurrence()
+		if err != nil {
+			return fmt.Errorf("%s, %w", location, err)
+		}
+
 		for _, ms := range e.posibleMappings {
 			if ms.StartSet != "" && m.Start.MatchString(ms.StartSet) {
 				for _, me := range e.posibleMappings {
 					if me.EndSet != "" && m.End.MatchString(me.EndSet) {
-						err := rm.MapRef(ctx, ms.StartSet, me.EndSet)
+						err := rm.MapRef(ctx, ms.StartSet, me.EndSet, recurrence)
 						if err != nil {
 							return err
 						}
@@ -233,6 +297,36 @@ func (e *Basic) Process(bb BranchBuilder, rm refmap.Mutator, ctx context.Context
 	return nil
 }
 
+// ExpandedFiles returns the files selected by the include patterns
+// in the last processing.
+func (e Basic) ExpandedFiles() map[string]*File {
+	return e.expanded
+}
+
+// SourceDirs returns the derived source paths of all the directories
+// below the entity.
+func (e Basic) SourceDirs() []string {
+	dirs := []string{}
+	for _, d := range e.Directories {
+		dirs = append(dirs, d.SrcDerived)
+		dirs = append(dirs, d.SourceDirs()...)
+	}
+	return dirs
+}
+
+// previous returns the hash of the node already in the refmap under
+// the identifier and whether it was flagged for an update, so that a
+// reprocessed node keeps a pending update. A node that was added but not
+// built yet, for instance when a rebuild was cancelled, counts as flagged.
+func previous(rm refmap.Grapher, id string) (string, bool) {
+	for _, n := range rm.Nodes("", id) {
+		if n.Identifier() == id {
+			return n.Hash(), n.State() == state.Updated || n.State() == state.Added
+		}
+	}
+	return "", false
+}
+
 func (e *Basic) ProcessState(s ...string) error {
 	if len(s) > 0 {
 		return e.Detect.ProcessState(s[0])
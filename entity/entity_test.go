@@ -104,3 +104,77 @@ func TestImportProcess(t *testing.T) {
 	assert.NotEmpty(t, e.Files)
 	assert.NotEmpty(t, e.Directories)
 }
+
+func TestMappingCycle(t *testing.T) {
+	f := bytes.NewBufferString(`{
+		"name": "abc",
+		"mappings": [
+			{"start": "file:a.ext", "end": "exec:cp"},
+			{"start": "exec:cp", "end": "file:a.ext"}
+		],
+		"files": {
+			"a.ext": {}
+		},
+		"execs": {
+			"cp": {
+				"cmd": ["cp", "a.ext", "b.ext"]
+			}
+		}
+	}`)
+
+	e := &entity.Basic{Detect: state.New()}
+	err := e.Load(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rm := refmap.Start()
+
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, refmap.ContextKey("orig"), "testing")
+	ctx = context.WithValue(ctx, refmap.ContextKey("dest"), "testing/out")
+	ctx = context.WithValue(ctx, refmap.ContextKey("verbose"), 0)
+
+	err = e.Process(&entity.Branch{}, rm, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = rm.Evaluate()
+	var cycle *refmap.CycleError
+	if assert.ErrorAs(t, err, &cycle) {
+		assert.Equal(t, []string{"exec:cp", "file:a.ext", "exec:cp"}, cycle.Path)
+		assert.Equal(t, []string{"mappings[1] in basic:abc", "mappings[0] in basic:abc"}, cycle.Origins)
+	}
+}
+
+func TestMappingRecurrence(t *testing.T) {
+	f := bytes.NewBufferString(`{
+		"name": "abc",
+		"mappings": [
+			{"start": "file:a.ext", "end": "file:b.ext", "recurrence": 5}
+		],
+		"files": {
+			"a.ext": {},
+			"b.ext": {}
+		}
+	}`)
+
+	e := &entity.Basic{Detect: state.New()}
+	err := e.Load(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rm := refmap.Start()
+
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, refmap.ContextKey("orig"), "testing")
+	ctx = context.WithValue(ctx, refmap.ContextKey("dest"), "testing/out")
+	ctx = context.WithValue(ctx, refmap.ContextKey("verbose"), 0)
+
+	err = e.Process(&entity.Branch{}, rm, ctx)
+	if assert.Error(t, err) {
+		assert.Equal(t, "mappings[0] in basic:abc, unknown recurrence 5", err.Error())
+	}
+}
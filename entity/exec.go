@@ -1,15 +1,19 @@
 package entity
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/oligoden/meta/cache"
 	"github.com/oligoden/meta/entity/state"
+	"github.com/oligoden/meta/profile"
 	"github.com/oligoden/meta/refmap"
 )
 
@@ -19,9 +23,14 @@ type CLE struct {
 	Timeout uint              `json:"timeout"`
 	Env     map[string]string `json:"env"`
 	Dir     string            `json:"dir"`
-	STDOut  *bytes.Buffer
-	STDErr  *bytes.Buffer
-	Parent  ConfigReader `json:"-"`
+	Log     bool              `json:"log"`
+	Cache   bool              `json:"cache"`
+	Inputs  []string          `json:"inputs"`
+	Outputs []string          `json:"outputs"`
+	Parent  ConfigReader      `json:"-"`
+	tail    *lineTail
+	err     error
+	cached  bool
 	*state.Detect
 }
 
@@ -37,35 +46,62 @@ func (e CLE) Identifier() string {
 	return "exec:" + e.Name
 }
 
+// Output returns a summary of the last run. The output of the
+// command is streamed while running, so only the tail of the
+// output is added when the command failed.
 func (e CLE) Output() string {
-	output := fmt.Sprintf("action %s was run", e.Name)
-	if e.STDOut.String() != "" {
-		output += "\nstdout: " + e.STDOut.String()
-		e.STDOut.Reset()
+	if e.cached {
+		return fmt.Sprintf("action %s was restored from cache", e.Name)
 	}
-	if e.STDErr.String() != "" {
-		output += "\nstderr: " + e.STDErr.String()
-		e.STDErr.Reset()
+
+	output := fmt.Sprintf("action %s was run", e.Name)
+	if e.err != nil {
+		if lines := e.tail.snapshot(); len(lines) > 0 {
+			output += "\nlast output:\n" + strings.Join(lines, "\n")
+		}
 	}
 	return output
 }
 
+// ExitCoder is a node running a command, such as a CLE, whose exit code
+// is reported for the node.
+type ExitCoder interface {
+	ExitCode() int
+}
+
+var _ ExitCoder = CLE{}
+
+// ExitCode returns the exit code of the last run of the command, or -1
+// if the command could not be started or was killed.
+func (e CLE) ExitCode() int {
+	if e.err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(e.err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
 func (e CLE) Derived() (string, string) {
 	return "", ""
 }
 
 func (e *CLE) Process(rm refmap.Mutator, ctx context.Context) error {
-	hash := ""
-	nodes := rm.Nodes("", e.Identifier())
-	if len(nodes) > 0 {
-		hash = nodes[0].Hash()
-	}
+	prof, _ := ctx.Value(refmap.ContextKey("profile")).(*profile.Profile)
+	defer prof.Add(e.Identifier(), profile.Process, time.Now())
+
+	hash, flagged := previous(rm, e.Identifier())
 	e.Detect = state.New(hash)
 
 	err := e.ProcessState()
 	if err != nil {
 		return err
 	}
+	if flagged {
+		e.FlagState()
+	}
 
 	for _, m := range e.Parent.ControlMappings() {
 		matchStart := m.Start.MatchString(e.Identifier())
@@ -99,6 +135,10 @@ func (e *CLE) Process(rm refmap.Mutator, ctx context.Context) error {
 }
 
 func (e *CLE) Perform(rm refmap.Grapher, ctx context.Context) error {
+	if e.Detect != nil && e.State() == state.Remove {
+		return nil
+	}
+
 	RootSrcDir := ctx.Value(refmap.ContextKey("orig")).(string)
 
 	if e.Timeout == 0 {
@@ -107,21 +147,112 @@ func (e *CLE) Perform(rm refmap.Grapher, ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(e.Timeout)*time.Millisecond)
 	defer cancel()
 
-	if e.STDErr == nil {
-		e.STDErr = &bytes.Buffer{}
+	out := &execOutput{
+		prefix: "[" + e.Name + "] ",
+		out:    os.Stdout,
+		tail:   newLineTail(defaultTailLines),
+	}
+	if w, ok := ctx.Value(refmap.ContextKey("stdout")).(io.Writer); ok {
+		out.out = w
+	}
+	e.tail = out.tail
+	e.cached = false
+
+	metaDir, ok := ctx.Value(refmap.ContextKey("meta")).(string)
+	if !ok {
+		metaDir = ".meta"
+	}
+	dir := filepath.Join(RootSrcDir, e.Dir)
+
+	// a run triggered by an upstream node over a mapping with
+	// recurrence 2 gets the upstream node in META_UPSTREAM
+	env := e.Env
+	if upstream, ok := ctx.Value(refmap.ContextKey("upstream")).(string); ok && upstream != "" {
+		env = map[string]string{"META_UPSTREAM": upstream}
+		for k, v := range e.Env {
+			env[k] = v
+		}
+	}
+
+	key := ""
+	var c *cache.Cache
+	if e.Cache {
+		var err error
+		key, err = cache.Key(e.Cmd, env, dir, e.Inputs)
+		if err != nil {
+			return fmt.Errorf("calculating cache key, %w", err)
+		}
+
+		c = cache.New(filepath.Join(metaDir, "cache"))
+		entry, hit, err := c.Get(key)
+		if err != nil {
+			return fmt.Errorf("reading cache, %w", err)
+		}
+
+		if hit {
+			err = c.Restore(entry, dir)
+			if err != nil {
+				return fmt.Errorf("restoring from cache, %w", err)
+			}
+
+			for _, l := range entry.Stdout {
+				out.line([]byte(l))
+			}
+			e.err = nil
+			e.cached = true
+			return nil
+		}
+
+		out.record = &[]string{}
 	}
-	if e.STDOut == nil {
-		e.STDOut = &bytes.Buffer{}
+
+	if e.Log {
+		logDir := filepath.Join(metaDir, "logs")
+		err := os.MkdirAll(logDir, os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("creating log directory, %w", err)
+		}
+
+		f, err := os.Create(filepath.Join(logDir, e.Name+".log"))
+		if err != nil {
+			return fmt.Errorf("creating log file, %w", err)
+		}
+		defer f.Close()
+		out.log = f
 	}
 
+	stdout := out.writer()
+	stderr := out.writer()
+
 	cmd := exec.CommandContext(ctx, e.Cmd[0], e.Cmd[1:]...)
-	cmd.Dir = filepath.Join(RootSrcDir, e.Dir)
-	cmd.Stdout = e.STDOut
-	cmd.Stderr = e.STDErr
-	for k, v := range e.Env {
-		cmd.Env = append(os.Environ(), fmt.Sprintf(`%s=%s`, k, v))
+	cmd.Dir = dir
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if len(env) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range env {
+			cmd.Env = append(cmd.Env, fmt.Sprintf(`%s=%s`, k, v))
+		}
+	}
+
+	start := time.Now()
+	e.err = cmd.Run()
+	prof, _ := ctx.Value(refmap.ContextKey("profile")).(*profile.Profile)
+	prof.Add(e.Identifier(), profile.Exec, start)
+	stdout.flush()
+	stderr.flush()
+	if e.err != nil {
+		return e.err
 	}
-	return cmd.Run()
+
+	if c != nil {
+		err := c.Put(key, *out.record, dir, e.Outputs)
+		if err != nil {
+			return fmt.Errorf("storing in cache, %w", err)
+		}
+	}
+
+	return nil
 }
 
 func (e *CLE) ProcessState() error {
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/oligoden/meta/entity"
@@ -122,3 +123,115 @@ func TestExecPerform(t *testing.T) {
 		assert.Equal("a", string(content))
 	}
 }
+
+func TestExecPerformStream(t *testing.T) {
+	assert := assert.New(t)
+
+	if err := os.MkdirAll("testing", 0755); err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll("testing")
+
+	out := &bytes.Buffer{}
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, refmap.ContextKey("orig"), "testing")
+	ctx = context.WithValue(ctx, refmap.ContextKey("dest"), "testing/out")
+	ctx = context.WithValue(ctx, refmap.ContextKey("meta"), "testing/.meta")
+	ctx = context.WithValue(ctx, refmap.ContextKey("verbose"), 0)
+	ctx = context.WithValue(ctx, refmap.ContextKey("stdout"), out)
+
+	cle := &entity.CLE{}
+	cle.Name = "echo"
+	cle.Cmd = []string{"sh", "-c", "echo a; echo b; printf c"}
+	cle.Log = true
+
+	assert.NoError(cle.Perform(nil, ctx))
+	assert.Equal("[echo] a\n[echo] b\n[echo] c\n", out.String())
+	assert.Equal("action echo was run", cle.Output())
+	assert.Equal(0, cle.ExitCode())
+
+	content, err := ioutil.ReadFile("testing/.meta/logs/echo.log")
+	if assert.NoError(err) {
+		assert.Equal("a\nb\nc\n", string(content))
+	}
+
+	out.Reset()
+	cle.Name = "fail"
+	cle.Cmd = []string{"sh", "-c", "echo a; echo b >&2; exit 1"}
+	cle.Log = false
+
+	assert.Error(cle.Perform(nil, ctx))
+	assert.Contains(out.String(), "[fail] a\n")
+	assert.Contains(out.String(), "[fail] b\n")
+	assert.Contains(cle.Output(), "action fail was run\nlast output:\n")
+	assert.Contains(cle.Output(), "b")
+	assert.Equal(1, cle.ExitCode())
+
+	// output without newlines is passed on in bounded parts
+	out.Reset()
+	cle.Name = "bar"
+	cle.Cmd = []string{"sh", "-c", "head -c 150000 /dev/zero | tr '\\0' a"}
+
+	assert.NoError(cle.Perform(nil, ctx))
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if assert.Len(lines, 3) {
+		assert.Equal("[bar] "+strings.Repeat("a", 64*1024), lines[0])
+		assert.Equal("[bar] "+strings.Repeat("a", 150000-2*64*1024), lines[2])
+	}
+	// a run triggered by an upstream node gets it in the environment
+	out.Reset()
+	cle.Name = "up"
+	cle.Cmd = []string{"sh", "-c", "echo $META_UPSTREAM"}
+
+	upCtx := context.WithValue(ctx, refmap.ContextKey("upstream"), "file:a.proto")
+	assert.NoError(cle.Perform(nil, upCtx))
+	assert.Equal("[up] file:a.proto\n", out.String())
+}
+
+func TestExecPerformCache(t *testing.T) {
+	assert := assert.New(t)
+
+	if err := os.MkdirAll("testing", 0755); err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll("testing")
+
+	if err := ioutil.WriteFile("testing/a.ext", []byte("a"), 0644); err != nil {
+		t.Error(err)
+	}
+
+	out := &bytes.Buffer{}
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, refmap.ContextKey("orig"), "testing")
+	ctx = context.WithValue(ctx, refmap.ContextKey("dest"), "testing/out")
+	ctx = context.WithValue(ctx, refmap.ContextKey("meta"), "testing/.meta")
+	ctx = context.WithValue(ctx, refmap.ContextKey("verbose"), 0)
+	ctx = context.WithValue(ctx, refmap.ContextKey("stdout"), out)
+
+	cle := &entity.CLE{}
+	cle.Name = "gen"
+	cle.Cmd = []string{"sh", "-c", "cat a.ext a.ext > b.ext; echo generated"}
+	cle.Cache = true
+	cle.Inputs = []string{"a.ext"}
+	cle.Outputs = []string{"b.ext"}
+
+	assert.NoError(cle.Perform(nil, ctx))
+	assert.Equal("action gen was run", cle.Output())
+	assert.NoError(os.Remove("testing/b.ext"))
+
+	out.Reset()
+	assert.NoError(cle.Perform(nil, ctx))
+	assert.Equal("action gen was restored from cache", cle.Output())
+	assert.Equal("[gen] generated\n", out.String())
+
+	content, err := ioutil.ReadFile("testing/b.ext")
+	if assert.NoError(err) {
+		assert.Equal("aa", string(content))
+	}
+
+	if err := ioutil.WriteFile("testing/a.ext", []byte("b"), 0644); err != nil {
+		t.Error(err)
+	}
+	assert.NoError(cle.Perform(nil, ctx))
+	assert.Equal("action gen was run", cle.Output())
+}
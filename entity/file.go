@@ -7,13 +7,14 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/oligoden/meta/entity/state"
+	"github.com/oligoden/meta/profile"
 	"github.com/oligoden/meta/refmap"
 )
 
@@ -24,9 +25,12 @@ type File struct {
 	Opts     string             `json:"options"`
 	Flts     filters            `json:"filters"`
 	Mpns     []*Mapping         `json:"mappings"`
+	Dlms     []string           `json:"delims"`
 	Template *template.Template `json:"-"`
 	Parent   ConfigReader       `json:"-"`
 	Branch   BranchBuilder      `json:"-"`
+	// the engines by extension of the parent
+	engines map[string]string
 	*state.Detect
 }
 
@@ -35,6 +39,11 @@ func (file File) Identifier() string {
 }
 
 func (e *File) Process(bb BranchBuilder, rm refmap.Mutator, ctx context.Context) error {
+	prof, _ := ctx.Value(refmap.ContextKey("profile")).(*profile.Profile)
+	defer func(start time.Time) {
+		prof.Add(e.Identifier(), profile.Process, start)
+	}(time.Now())
+
 	if e.Flts == nil {
 		e.Flts = filters{}
 	}
@@ -59,6 +68,11 @@ func (e *File) Process(bb BranchBuilder, rm refmap.Mutator, ctx context.Context)
 		}
 	}
 
+	if e.Dlms == nil {
+		e.Dlms = e.Parent.Delimiters()
+	}
+	e.engines = e.Parent.Engines()
+
 	if e.Vars == nil {
 		e.Vars = map[string]string{}
 	}
@@ -68,17 +82,28 @@ func (e *File) Process(bb BranchBuilder, rm refmap.Mutator, ctx context.Context)
 		}
 	}
 
-	hash := ""
-	nodes := rm.Nodes("", e.Identifier())
-	if len(nodes) > 0 {
-		hash = nodes[0].Hash()
+	srcDerived, _ := e.Parent.Derived()
+	if e.Source == "" {
+		e.Source = filepath.Join(srcDerived, e.Name)
+	} //else if strings.HasPrefix(e.Source, "./") {
+	// 	e.Source = filepath.Join(parent.SrcDerived, e.Source)
+	// }
+
+	err := validDelims(e.Dlms)
+	if err != nil {
+		return fmt.Errorf("%s, %w", e.Identifier(), err)
 	}
+
+	hash, flagged := previous(rm, e.Identifier())
 	e.Detect = state.New(hash)
 
-	err := e.ProcessState()
+	err = e.ProcessState()
 	if err != nil {
 		return err
 	}
+	if flagged {
+		e.FlagState()
+	}
 
 	e.Branch = bb.Clone()
 	_, err = e.Branch.Build(e)
@@ -86,13 +111,6 @@ func (e *File) Process(bb BranchBuilder, rm refmap.Mutator, ctx context.Context)
 		return fmt.Errorf("building branch, %w", err)
 	}
 
-	srcDerived, _ := e.Parent.Derived()
-	if e.Source == "" {
-		e.Source = filepath.Join(srcDerived, e.Name)
-	} //else if strings.HasPrefix(e.Source, "./") {
-	// 	e.Source = filepath.Join(parent.SrcDerived, e.Source)
-	// }
-
 	for _, m := range e.Parent.ControlMappings() {
 		matchStart := m.Start.MatchString(e.Identifier())
 		matchEnd := m.End.MatchString(e.Identifier())
@@ -121,137 +139,229 @@ func (e *File) Process(bb BranchBuilder, rm refmap.Mutator, ctx context.Context)
 		return fmt.Errorf("mapping nodes, %w", err)
 	}
 
+	rootSrcDir, _ := ctx.Value(refmap.ContextKey("orig")).(string)
+	err = rm.AddInput(ctx, e.Identifier(), filepath.Join(rootSrcDir, e.Source))
+	if err != nil {
+		return fmt.Errorf("adding input, %w", err)
+	}
+
 	return nil
 }
 
 func (file *File) Perform(rm refmap.Grapher, ctx context.Context) error {
-	verboseValue := ctx.Value(refmap.ContextKey("verbose")).(int)
-	srcFilename := filepath.Base(file.Source)
+	logger := refmap.Logger(ctx).With("node", file.Identifier())
+	prof, _ := ctx.Value(refmap.ContextKey("profile")).(*profile.Profile)
+	srcFile, dstFile := file.paths(ctx)
 
 	if !strings.Contains(file.Opts, "output") {
-		if verboseValue >= 2 {
-			fmt.Println("not outputing", srcFilename)
-		}
+		logger.Log(ctx, refmap.LevelDetail, "not outputting file", "file", srcFile)
 		return nil
 	}
 
-	if verboseValue >= 3 {
-		fmt.Println("writing", srcFilename)
+	logger.Log(ctx, refmap.LevelTrace, "writing file", "file", srcFile)
+
+	if file.Detect != nil && file.State() == state.Remove {
+		logger.Log(ctx, refmap.LevelTrace, "deleting file set for removal", "file", dstFile)
+
+		err := os.Remove(dstFile)
+		if err != nil && !os.IsNotExist(err) {
+			logger.Error("error deleting file", "file", dstFile, "err", err)
+		}
+		return nil
 	}
 
-	defaultSrcDir, defaultDstDir := "", ""
-	if file.Parent != nil {
-		defaultSrcDir, defaultDstDir = file.Parent.Derived()
+	_, err := os.Stat(dstFile)
+	if os.IsNotExist(err) {
+		os.MkdirAll(filepath.Dir(dstFile), os.ModePerm)
+	} else if err != nil {
+		return fmt.Errorf("stating destination file %s -> %w", dstFile, err)
 	}
 
-	RootSrcDir := ctx.Value(refmap.ContextKey("orig")).(string)
-	srcDirectory := filepath.Join(RootSrcDir, defaultSrcDir)
-	srcFile := filepath.Join(srcDirectory, srcFilename)
-	// srcDirSpecific := filepath.Join(RootSrcDir, filepath.Dir(file.Source))
-	// srcFileSpecific := filepath.Join(srcDirSpecific, srcFilename)
+	r := &reads{}
+	outputBuf, err := file.render(rm, ctx, r)
+	regErr := file.register(rm, ctx, r)
+	if err != nil {
+		return err
+	}
+	if regErr != nil {
+		return regErr
+	}
 
-	RootDstDir := ctx.Value(refmap.ContextKey("dest")).(string)
-	dstFilename := strings.TrimSuffix(file.Name, ".tmpl")
-	dstDirectory := filepath.Join(RootDstDir, defaultDstDir)
-	dstFile := filepath.Join(dstDirectory, dstFilename)
+	start := time.Now()
+	f, err := os.OpenFile(dstFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("opening destination file %s for writing -> %w", dstFile, err)
+	}
 
-	_, err := os.Stat(dstFile)
-	if err == nil {
-		if nd := rm.Nodes("", file.Identifier()); len(nd) > 0 {
-			if nd[0].State() == state.Remove {
-				if verboseValue >= 3 {
-					fmt.Println(dstFile, "set for removal, deleting")
-				}
+	_, err = outputBuf.WriteTo(f)
+	if err != nil {
+		return fmt.Errorf("error writing to file, %w", err)
+	}
 
-				err := os.Remove(dstFile)
-				if err != nil {
-					fmt.Println("error deleting file", dstFile)
-				}
-				return nil
-			}
-		}
-	} else if os.IsNotExist(err) {
-		os.MkdirAll(dstDirectory, os.ModePerm)
-	} else {
-		return fmt.Errorf("stating destination file %s -> %w", dstFile, err)
+	if err := f.Close(); err != nil {
+		logger.Error("error closing file", "file", dstFile, "err", err)
 	}
+	prof.Add(file.Identifier(), profile.Write, start)
+
+	return nil
+}
+
+// Render returns the content of the file, with the template executed on
+// the branch by the engine of the file and the filters applied, or the
+// source for copied files. The templates of the parent files are added
+// to the template. Rendering does not change the graph, the files and
+// nodes read are registered by Perform.
+func (file *File) Render(rm refmap.Grapher, ctx context.Context) (*bytes.Buffer, error) {
+	return file.render(rm, ctx, &reads{})
+}
+
+// reads are the files and nodes read while rendering a file.
+type reads struct {
+	inputs   []string
+	matchers []refmap.Matcher
+}
 
+// render renders the file, recording the files and nodes read, also
+// when rendering fails.
+func (file *File) render(rm refmap.Grapher, ctx context.Context, r *reads) (*bytes.Buffer, error) {
+	prof, _ := ctx.Value(refmap.ContextKey("profile")).(*profile.Profile)
+	srcFile, _ := file.paths(ctx)
 	contentBuf := &bytes.Buffer{}
 
+	start := time.Now()
 	if strings.Contains(file.Opts, "copy") {
 		r, err := os.Open(srcFile)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		defer r.Close()
 		_, err = io.Copy(contentBuf, r)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		prof.Add(file.Identifier(), profile.Copy, start)
 	} else {
-		fileContent, err := ioutil.ReadFile(srcFile)
+		engine, _, err := file.engine()
 		if err != nil {
-			return err
+			return nil, err
 		}
-
-		tmpl, err := template.New(srcFile).
-			Option("missingkey=error").
-			Parse(string(fileContent))
+		src, err := file.source(rm, ctx, r)
 		if err != nil {
-			return err
+			return nil, err
 		}
-
-		if rm != nil {
-			for _, t := range rm.ParentFiles(file.Identifier()) {
-				filename := strings.TrimPrefix(t, "file:")
-				filename = filepath.Join(RootSrcDir, filename)
-
-				fileContent, err := ioutil.ReadFile(filename)
-				if err != nil {
-					return err
-				}
-
-				tmpl, err = tmpl.New(filename).
-					Option("missingkey=error").
-					Parse(string(fileContent))
-				if err != nil {
-					return err
-				}
-			}
+		tmpl, err := engine.Parse(src)
+		if err != nil {
+			return nil, err
 		}
+		prof.Add(file.Identifier(), profile.Parse, start)
 
-		err = tmpl.Lookup(srcFile).Execute(contentBuf, file.Branch)
+		start = time.Now()
+		err = tmpl.Execute(contentBuf, file.Branch)
 		if err != nil {
-			return fmt.Errorf("error executing template -> %w", err)
+			return nil, fmt.Errorf("error executing template -> %w", err)
 		}
+		prof.Add(file.Identifier(), profile.Execute, start)
 	}
 
+	start = time.Now()
 	outputBuf := &bytes.Buffer{}
 
 	if file.ContainsFilter("comment") {
 		err := commentFilter(contentBuf, outputBuf)
 		if err != nil {
-			return fmt.Errorf("error with comment filter, %w", err)
+			return nil, fmt.Errorf("error with comment filter, %w", err)
 		}
 	} else {
 		contentBuf.WriteTo(outputBuf)
 	}
+	prof.Add(file.Identifier(), profile.Filter, start)
 
-	f, err := os.OpenFile(dstFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	return outputBuf, nil
+}
+
+// register registers the files read as inputs of the file and the nodes
+// read as its queries, replacing the queries of the last build.
+func (file *File) register(rm refmap.Grapher, ctx context.Context, r *reads) error {
+	if in, ok := rm.(refmap.Inputter); ok {
+		for _, filename := range r.inputs {
+			err := in.AddInput(ctx, file.Identifier(), filename)
+			if err != nil {
+				return fmt.Errorf("adding input %s, %w", filename, err)
+			}
+		}
+	}
+	if q, ok := rm.(refmap.Querier); ok {
+		err := q.SetQueries(ctx, file.Identifier(), r.matchers...)
+		if err != nil {
+			return fmt.Errorf("registering queries, %w", err)
+		}
+	}
+	return nil
+}
+
+// template parses the source of the file with text/template, as done
+// by the text and html engines.
+func (file *File) template(rm refmap.Grapher, ctx context.Context) (*template.Template, error) {
+	src, err := file.source(rm, ctx, &reads{})
 	if err != nil {
-		return fmt.Errorf("opening destination file %s for writing -> %w", dstFile, err)
+		return nil, err
 	}
+	return parseText(src)
+}
 
-	_, err = outputBuf.WriteTo(f)
+// source reads the template of the file and the templates of the parent
+// files, which are recorded as inputs of the file. The parent templates
+// keep their own delimiters.
+func (file *File) source(rm refmap.Grapher, ctx context.Context, r *reads) (Source, error) {
+	srcFile, _ := file.paths(ctx)
+	fileContent, err := ioutil.ReadFile(srcFile)
 	if err != nil {
-		return fmt.Errorf("error writing to file, %w", err)
+		return Source{}, err
 	}
 
-	if err := f.Close(); err != nil {
-		log.Println("error closing file", err)
+	funcs := FuncMap()
+	for name, fn := range helpers(ctx).Funcs(ctx) {
+		funcs[name] = fn
+	}
+	for name, fn := range file.treeFuncs(rm, r) {
+		funcs[name] = fn
 	}
 
-	return nil
+	src := Source{
+		Name:    srcFile,
+		Content: string(fileContent),
+		Delims:  file.Dlms,
+		Funcs:   funcs,
+	}
+
+	if rm != nil {
+		RootSrcDir := ctx.Value(refmap.ContextKey("orig")).(string)
+		for _, t := range rm.ParentFiles(file.Identifier()) {
+			filename := strings.TrimPrefix(t, "file:")
+			filename = filepath.Join(RootSrcDir, filename)
+
+			fileContent, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return Source{}, err
+			}
+
+			// the parent templates are inputs of the file as well
+			r.inputs = append(r.inputs, filename)
+
+			// the file itself is among the parent files
+			if t == file.Identifier() {
+				continue
+			}
+			parent := Source{Name: filename, Content: string(fileContent)}
+			for _, n := range rm.Nodes("", t) {
+				if f, ok := n.(*File); ok && n.Identifier() == t {
+					parent.Delims = f.Dlms
+				}
+			}
+			src.Parents = append(src.Parents, parent)
+		}
+	}
+	return src, nil
 }
 
 func (e File) ContainsFilter(filter string) bool {
@@ -261,6 +371,55 @@ func (e File) ContainsFilter(filter string) bool {
 	return false
 }
 
+// Destinationer is a node writing a file, such as a File, whose path is
+// reported for the node.
+type Destinationer interface {
+	Destination(context.Context) string
+}
+
+var _ Destinationer = (*File)(nil)
+
+// Destination returns the path the file is written to, or an empty
+// string if the file is not output.
+func (file *File) Destination(ctx context.Context) string {
+	if !strings.Contains(file.Opts, "output") {
+		return ""
+	}
+	_, dstFile := file.paths(ctx)
+	return dstFile
+}
+
+// paths returns the source and destination paths of the file.
+func (file *File) paths(ctx context.Context) (string, string) {
+	srcFilename := filepath.Base(file.Source)
+	if strings.Contains(file.Name, "/") {
+		// files of a file set keep their path relative to the directory
+		srcFilename = filepath.FromSlash(file.Name)
+	}
+
+	defaultSrcDir := ""
+	if file.Parent != nil {
+		defaultSrcDir, _ = file.Parent.Derived()
+	}
+
+	RootSrcDir := ctx.Value(refmap.ContextKey("orig")).(string)
+	srcFile := filepath.Join(RootSrcDir, defaultSrcDir, srcFilename)
+
+	RootDstDir := ctx.Value(refmap.ContextKey("dest")).(string)
+	dstFile := filepath.Join(RootDstDir, file.dest())
+	return srcFile, dstFile
+}
+
+// dest returns the destination path of the file relative to the base
+// destination directory.
+func (file *File) dest() string {
+	defaultDstDir := ""
+	if file.Parent != nil {
+		_, defaultDstDir = file.Parent.Derived()
+	}
+	return filepath.Join(defaultDstDir, strings.TrimSuffix(file.Name, ".tmpl"))
+}
+
 func (f File) Output() string {
 	return ""
 }
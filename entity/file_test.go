@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/oligoden/meta/entity"
 	"github.com/oligoden/meta/entity/state"
+	"github.com/oligoden/meta/profile"
 	"github.com/oligoden/meta/refmap"
 	"github.com/stretchr/testify/assert"
 )
@@ -187,6 +189,8 @@ func TestFilePerform(t *testing.T) {
 	ctx = context.WithValue(ctx, refmap.ContextKey("orig"), "testing")
 	ctx = context.WithValue(ctx, refmap.ContextKey("dest"), "testing/out")
 	ctx = context.WithValue(ctx, refmap.ContextKey("verbose"), 0)
+	prof := profile.New()
+	ctx = context.WithValue(ctx, refmap.ContextKey("profile"), prof)
 
 	err = e.Process(&entity.Branch{}, rm, ctx)
 	if err != nil {
@@ -205,6 +209,17 @@ func TestFilePerform(t *testing.T) {
 		}
 	}
 
+	for _, n := range prof.Nodes() {
+		if !strings.HasPrefix(n.ID, "file:") {
+			continue
+		}
+		for _, phase := range []string{profile.Process, profile.Parse, profile.Execute, profile.Filter, profile.Write} {
+			if _, ok := n.Phases[phase]; !ok {
+				t.Errorf("expected %s phase of %s", phase, n.ID)
+			}
+		}
+	}
+
 	if _, err := os.Stat("testing/out/a.ext"); err != nil {
 		t.Error(err)
 	}
@@ -230,6 +245,103 @@ func TestFilePerform(t *testing.T) {
 	if exp != got {
 		t.Errorf(`expected "%s", got "%s"`, exp, got)
 	}
+
+	for _, ref := range rm.Nodes() {
+		if ref.Identifier() != "file:b.ext" {
+			continue
+		}
+		exp = filepath.Join("testing", "out", "b.ext")
+		got = ref.(*entity.File).Destination(ctx)
+		if exp != got {
+			t.Errorf(`expected "%s", got "%s"`, exp, got)
+		}
+
+		out, err := ref.(*entity.File).Render(rm, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp = "a b"
+		got = out.String()
+		if exp != got {
+			t.Errorf(`expected "%s", got "%s"`, exp, got)
+		}
+	}
+}
+
+func TestFileLint(t *testing.T) {
+	if err := os.MkdirAll("testing", 0755); err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll("testing")
+
+	c := []byte(`{{define "a"}}{{.Vars.a}}{{.Vars.missing}}{{end}}`)
+	if err := ioutil.WriteFile("testing/a.ext", c, 0644); err != nil {
+		t.Error(err)
+	}
+
+	c = []byte(`{{template "a" .}}{{template "none"}}{{.Filename}}{{.Bad}}{{range .Directories}}{{.Any}}{{end}}{{$.Vars.b}}`)
+	if err := ioutil.WriteFile("testing/b.ext", c, 0644); err != nil {
+		t.Error(err)
+	}
+
+	c = []byte(`{{.Vars.a`)
+	if err := ioutil.WriteFile("testing/c.ext", c, 0644); err != nil {
+		t.Error(err)
+	}
+
+	f := bytes.NewBufferString(`{
+		"name": "abc",
+		"vars": {"a": "1"},
+		"mappings": [
+			{"start": "file:a.ext", "end": "file:b.ext"}
+		],
+		"files": {
+			"a.ext": {},
+			"b.ext": {},
+			"c.ext": {}
+		}
+	}`)
+
+	e := &entity.Basic{Detect: state.New()}
+	err := e.Load(f)
+	if err != nil {
+		t.Error("loading config")
+	}
+
+	rm := refmap.Start()
+
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, refmap.ContextKey("orig"), "testing")
+	ctx = context.WithValue(ctx, refmap.ContextKey("dest"), "testing/out")
+
+	err = e.Process(&entity.Branch{}, rm, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = rm.Evaluate()
+	if err != nil {
+		t.Error("error evaluating refmap", err)
+	}
+
+	problems := map[string][]string{}
+	for _, ref := range rm.Nodes() {
+		if file, ok := ref.(*entity.File); ok {
+			for _, err := range file.Lint(rm, ctx) {
+				problems[ref.Identifier()] = append(problems[ref.Identifier()], err.Error())
+			}
+		}
+	}
+
+	assert := assert.New(t)
+	assert.Empty(problems["file:a.ext"])
+	if assert.Len(problems["file:b.ext"], 4) {
+		assert.Contains(problems["file:b.ext"][0], `map has no entry for key "missing"`)
+		assert.Contains(problems["file:b.ext"][1], `template "none" is not defined`)
+		assert.Contains(problems["file:b.ext"][2], "can't evaluate field Bad")
+		assert.Contains(problems["file:b.ext"][3], `map has no entry for key "b"`)
+	}
+	assert.Len(problems["file:c.ext"], 1)
 }
 
 func TestFilePerformCopy(t *testing.T) {
@@ -0,0 +1,152 @@
+package entity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/oligoden/meta/glob"
+	"github.com/oligoden/meta/ignore"
+	"github.com/oligoden/meta/refmap"
+)
+
+// FileSet selects the source files of a directory with a glob pattern
+// relative to the directory. It is given as the pattern only or as an
+// object that also sets the options and vars of the selected files.
+type FileSet struct {
+	Pattern string            `json:"pattern"`
+	Opts    string            `json:"options"`
+	Vars    map[string]string `json:"vars"`
+}
+
+func (s *FileSet) UnmarshalJSON(data []byte) error {
+	var pattern string
+	if err := json.Unmarshal(data, &pattern); err == nil {
+		*s = FileSet{Pattern: pattern}
+		return nil
+	}
+
+	type fileSet FileSet
+	fset := fileSet{}
+	if err := json.Unmarshal(data, &fset); err != nil {
+		return err
+	}
+	*s = FileSet(fset)
+	return nil
+}
+
+// expand adds a file for every source file selected by the include
+// patterns and not matched by an exclude pattern. Exclude patterns
+// without a slash are matched against the file name at any depth.
+// Files listed explicitly and files in configured subdirectories are
+// left to their own entries and paths in .metaignore files are skipped.
+func (e *Basic) expand(ctx context.Context) error {
+	e.expanded = map[string]*File{}
+	if len(e.Include) == 0 {
+		return nil
+	}
+
+	location := e.This.Identifier()
+
+	includes := make([]*regexp.Regexp, len(e.Include))
+	for i, set := range e.Include {
+		var err error
+		includes[i], err = glob.Compile(set.Pattern)
+		if err != nil {
+			return fmt.Errorf("include[%d] in %s, %w", i, location, err)
+		}
+	}
+
+	excludes := make([]*regexp.Regexp, len(e.Exclude))
+	for i, pattern := range e.Exclude {
+		var err error
+		excludes[i], err = glob.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("exclude[%d] in %s, %w", i, location, err)
+		}
+	}
+
+	rootSrcDir := ctx.Value(refmap.ContextKey("orig")).(string)
+	root := filepath.Join(rootSrcDir, e.SrcDerived)
+
+	ignored, ok := ctx.Value(refmap.ContextKey("ignore")).(*ignore.Matcher)
+	if !ok {
+		ignored = ignore.New(rootSrcDir)
+	}
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if rel == "." {
+				return nil
+			}
+			if _, ok := e.Directories[rel]; ok || d.Name() == ".meta" {
+				return filepath.SkipDir
+			}
+			if ignored.Ignored(path, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if ignored.Ignored(path, false) || d.Name() == ignore.Filename {
+			return nil
+		}
+
+		if _, ok := e.Files[rel]; ok {
+			return nil
+		}
+		if rel == "meta.json" && e.Import {
+			return nil
+		}
+
+		for i, re := range excludes {
+			target := rel
+			if !strings.Contains(e.Exclude[i], "/") {
+				target = d.Name()
+			}
+			if re.MatchString(target) {
+				return nil
+			}
+		}
+
+		for i, re := range includes {
+			if !re.MatchString(rel) {
+				continue
+			}
+
+			vars := map[string]string{}
+			for k, v := range e.Include[i].Vars {
+				vars[k] = v
+			}
+			e.expanded[rel] = &File{
+				Opts: e.Include[i].Opts,
+				Vars: vars,
+			}
+			break
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("expanding file sets in %s, %w", location, err)
+	}
+
+	return nil
+}
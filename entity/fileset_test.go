@@ -0,0 +1,176 @@
+package entity_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/oligoden/meta/entity"
+	"github.com/oligoden/meta/entity/state"
+	"github.com/oligoden/meta/refmap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSetExpand(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, dir := range []string{"testing/a/sub", "testing/a/conf"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.RemoveAll("testing")
+
+	for name, content := range map[string]string{
+		"testing/a/a.go":          "a",
+		"testing/a/a_test.go":     "a",
+		"testing/a/sub/b.go":      "{{.Filename}}",
+		"testing/a/sub/b_test.go": "b",
+		"testing/a/c.txt":         "{{.Filename}}",
+		"testing/a/conf/d.go":     "d",
+		"testing/a/listed.go":     "l",
+	} {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := bytes.NewBufferString(`{
+		"name": "abc",
+		"options": "output",
+		"dirs": {
+			"a": {
+				"include": [
+					"**/*.go",
+					{"pattern": "*.txt", "options": "copy", "vars": {"k": "v"}}
+				],
+				"exclude": ["*_test.go"],
+				"files": {
+					"listed.go": {"vars": {"listed": "yes"}}
+				},
+				"dirs": {
+					"conf": {}
+				}
+			}
+		}
+	}`)
+
+	e := &entity.Basic{Detect: state.New()}
+	err := e.Load(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rm := refmap.Start()
+
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, refmap.ContextKey("orig"), "testing")
+	ctx = context.WithValue(ctx, refmap.ContextKey("dest"), "testing/out")
+	ctx = context.WithValue(ctx, refmap.ContextKey("verbose"), 0)
+
+	err = e.Process(&entity.Branch{}, rm, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(rm.Evaluate())
+
+	expanded := e.Directories["a"].ExpandedFiles()
+	names := []string{}
+	for name := range expanded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	assert.Equal([]string{"a.go", "c.txt", "sub/b.go"}, names)
+
+	assert.Equal("file:a/sub/b.go", expanded["sub/b.go"].Identifier())
+	assert.Equal("v", expanded["c.txt"].Vars["k"])
+	assert.True(strings.Contains(expanded["c.txt"].Opts, "copy"))
+	assert.False(strings.Contains(expanded["a.go"].Opts, "copy"))
+
+	for _, ref := range rm.ChangedRefs() {
+		assert.NoError(ref.Perform(rm, ctx))
+	}
+
+	content, err := ioutil.ReadFile("testing/out/a/sub/b.go")
+	if assert.NoError(err) {
+		assert.Equal("sub/b.go", string(content))
+	}
+	content, err = ioutil.ReadFile("testing/out/a/c.txt")
+	if assert.NoError(err) {
+		assert.Equal("{{.Filename}}", string(content))
+	}
+	rm.Finish()
+
+	assert.NoError(os.Remove("testing/a/sub/b.go"))
+
+	err = e.Process(&entity.Branch{}, rm, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(e.Directories["a"].ExpandedFiles(), "sub/b.go")
+
+	rm.Assess()
+	removed := []string{}
+	for _, ref := range rm.ChangedRefs() {
+		if ref.State() == state.Remove {
+			removed = append(removed, ref.Identifier())
+		}
+		assert.NoError(ref.Perform(rm, ctx))
+	}
+	assert.Equal([]string{"file:a/sub/b.go"}, removed)
+
+	_, err = os.Stat("testing/out/a/sub/b.go")
+	assert.True(os.IsNotExist(err))
+}
+
+func TestFileSetIgnore(t *testing.T) {
+	if err := os.MkdirAll("testing/a/node_modules/lib", 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll("testing")
+
+	for name, content := range map[string]string{
+		"testing/.metaignore":                 "node_modules/\n",
+		"testing/a/.metaignore":               "*.swp\n",
+		"testing/a/a.js":                      "a",
+		"testing/a/.a.js.swp":                 "a",
+		"testing/a/node_modules/lib/index.js": "l",
+	} {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := bytes.NewBufferString(`{
+		"name": "abc",
+		"dirs": {
+			"a": {"include": ["**"]}
+		}
+	}`)
+
+	e := &entity.Basic{Detect: state.New()}
+	err := e.Load(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, refmap.ContextKey("orig"), "testing")
+	ctx = context.WithValue(ctx, refmap.ContextKey("dest"), "testing/out")
+	ctx = context.WithValue(ctx, refmap.ContextKey("verbose"), 0)
+
+	err = e.Process(&entity.Branch{}, refmap.Start(), ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for name := range e.Directories["a"].ExpandedFiles() {
+		names = append(names, name)
+	}
+	assert.Equal(t, []string{"a.js"}, names)
+}
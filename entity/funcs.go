@@ -0,0 +1,325 @@
+package entity
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"unicode"
+
+	"github.com/jinzhu/inflection"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	registeredMu sync.Mutex
+	registered   = template.FuncMap{}
+)
+
+// RegisterFuncs adds functions to the templates of all files, replacing
+// the functions of Meta with the same names. It is meant for builds of
+// Meta with domain specific functions, and is called before running the
+// commands, for example in an init function.
+func RegisterFuncs(funcs template.FuncMap) {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+
+	for name, fn := range funcs {
+		registered[name] = fn
+	}
+}
+
+// FuncMap returns the functions available in the templates of all
+// files, including the templates of parent files, with the registered
+// functions added.
+func FuncMap() template.FuncMap {
+	funcs := builtinFuncs()
+
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+
+	for name, fn := range registered {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+func builtinFuncs() template.FuncMap {
+	return template.FuncMap{
+		// strings
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"contains":   func(sub, s string) bool { return strings.Contains(s, sub) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"repeat":     func(n int, s string) string { return strings.Repeat(s, n) },
+		"camel":      camel,
+		"pascal":     pascal,
+		"snake":      func(s string) string { return strings.Join(lowerWords(s), "_") },
+		"kebab":      func(s string) string { return strings.Join(lowerWords(s), "-") },
+		"singular":   inflection.Singular,
+		"plural":     inflection.Plural,
+		"indent":     indent,
+		"nindent":    func(n int, s string) string { return "\n" + indent(n, s) },
+		"join":       join,
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+
+		// defaults
+		"default":  func(def, v interface{}) interface{} { return coalesce(v, def) },
+		"coalesce": coalesce,
+		"empty":    empty,
+
+		// collections
+		"list": func(v ...interface{}) []interface{} { return v },
+		"dict": dict,
+
+		// encoding
+		"toJson":       toJSON,
+		"toPrettyJson": toPrettyJSON,
+		"toYaml":       toYAML,
+
+		// math
+		"add": func(a, b interface{}) (int64, error) { return arith(a, b, func(a, b int64) int64 { return a + b }) },
+		"sub": func(a, b interface{}) (int64, error) { return arith(a, b, func(a, b int64) int64 { return a - b }) },
+		"mul": func(a, b interface{}) (int64, error) { return arith(a, b, func(a, b int64) int64 { return a * b }) },
+		"div": div,
+		"mod": mod,
+		"max": func(a, b interface{}) (int64, error) {
+			return arith(a, b, func(a, b int64) int64 {
+				if a > b {
+					return a
+				}
+				return b
+			})
+		},
+		"min": func(a, b interface{}) (int64, error) {
+			return arith(a, b, func(a, b int64) int64 {
+				if a < b {
+					return a
+				}
+				return b
+			})
+		},
+
+		// hashing
+		"md5":    func(s string) string { h := md5.Sum([]byte(s)); return hex.EncodeToString(h[:]) },
+		"sha1":   func(s string) string { h := sha1.Sum([]byte(s)); return hex.EncodeToString(h[:]) },
+		"sha256": func(s string) string { h := sha256.Sum256([]byte(s)); return hex.EncodeToString(h[:]) },
+	}
+}
+
+// words splits the string into words at separators and at changes from
+// lower to upper case, so that "someHTTPServer_name" gives "some",
+// "HTTP", "Server" and "name".
+func words(s string) []string {
+	ws := []string{}
+	rs := []rune(s)
+	start := -1
+	for i, r := range rs {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if start >= 0 {
+				ws = append(ws, string(rs[start:i]))
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+			continue
+		}
+		if unicode.IsUpper(r) {
+			prev := rs[i-1]
+			next := i+1 < len(rs) && unicode.IsLower(rs[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && next) {
+				ws = append(ws, string(rs[start:i]))
+				start = i
+			}
+		}
+	}
+	if start >= 0 {
+		ws = append(ws, string(rs[start:]))
+	}
+	return ws
+}
+
+func lowerWords(s string) []string {
+	ws := words(s)
+	for i, w := range ws {
+		ws[i] = strings.ToLower(w)
+	}
+	return ws
+}
+
+func pascal(s string) string {
+	b := &strings.Builder{}
+	for _, w := range lowerWords(s) {
+		rs := []rune(w)
+		b.WriteRune(unicode.ToUpper(rs[0]))
+		b.WriteString(string(rs[1:]))
+	}
+	return b.String()
+}
+
+func camel(s string) string {
+	rs := []rune(pascal(s))
+	if len(rs) == 0 {
+		return ""
+	}
+	rs[0] = unicode.ToLower(rs[0])
+	return string(rs)
+}
+
+// indent indents every line that is not empty with n spaces.
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if l != "" {
+			lines[i] = pad + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// join joins the elements of a slice or array with the separator.
+func join(sep string, v interface{}) (string, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", fmt.Errorf("join of %T, expected a list", v)
+	}
+	ss := make([]string, rv.Len())
+	for i := range ss {
+		ss[i] = fmt.Sprint(rv.Index(i).Interface())
+	}
+	return strings.Join(ss, sep), nil
+}
+
+// empty reports whether the value is the zero value of its type or an
+// empty map, slice or string.
+func empty(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return true
+	}
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.String:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
+
+// coalesce returns the first value that is not empty, or nil.
+func coalesce(v ...interface{}) interface{} {
+	for _, e := range v {
+		if !empty(e) {
+			return e
+		}
+	}
+	return nil
+}
+
+// dict returns a map of the key and value pairs.
+func dict(v ...interface{}) (map[string]interface{}, error) {
+	if len(v)%2 != 0 {
+		return nil, fmt.Errorf("dict of %d values, expected key and value pairs", len(v))
+	}
+	d := map[string]interface{}{}
+	for i := 0; i < len(v); i += 2 {
+		k, ok := v[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict key %v is not a string", v[i])
+		}
+		d[k] = v[i+1]
+	}
+	return d, nil
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("encoding json, %w", err)
+	}
+	return string(b), nil
+}
+
+func toPrettyJSON(v interface{}) (string, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("encoding json, %w", err)
+	}
+	return string(b), nil
+}
+
+// toYAML encodes the value as YAML without the trailing newline.
+func toYAML(v interface{}) (string, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("encoding yaml, %w", err)
+	}
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
+
+// toInt converts numbers and numeric strings, such as vars, to an int64.
+func toInt(v interface{}) (int64, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return int64(rv.Float()), nil
+	case reflect.String:
+		i, err := strconv.ParseInt(strings.TrimSpace(rv.String()), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", rv.String())
+		}
+		return i, nil
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+func arith(a, b interface{}, f func(a, b int64) int64) (int64, error) {
+	x, err := toInt(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := toInt(b)
+	if err != nil {
+		return 0, err
+	}
+	return f(x, y), nil
+}
+
+func div(a, b interface{}) (int64, error) {
+	y, err := toInt(b)
+	if err != nil {
+		return 0, err
+	}
+	if y == 0 {
+		return 0, fmt.Errorf("division by zero")
+	}
+	return arith(a, y, func(a, b int64) int64 { return a / b })
+}
+
+func mod(a, b interface{}) (int64, error) {
+	y, err := toInt(b)
+	if err != nil {
+		return 0, err
+	}
+	if y == 0 {
+		return 0, fmt.Errorf("division by zero")
+	}
+	return arith(a, y, func(a, b int64) int64 { return a % b })
+}
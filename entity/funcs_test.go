@@ -0,0 +1,136 @@
+package entity_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/oligoden/meta/entity"
+	"github.com/oligoden/meta/entity/state"
+	"github.com/oligoden/meta/refmap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFuncMap(t *testing.T) {
+	testCases := []struct {
+		desc string
+		tmpl string
+		exp  string
+	}{
+		{"camel", `{{camel "some HTTP_server-name"}}`, "someHttpServerName"},
+		{"pascal", `{{pascal "someHTTPServer"}}`, "SomeHttpServer"},
+		{"snake", `{{snake "SomeHTTPServer v2"}}`, "some_http_server_v2"},
+		{"kebab", `{{"userID" | kebab}}`, "user-id"},
+		{"plural", `{{plural "person"}} {{singular "users"}}`, "people user"},
+		{"indent", `{{indent 2 "a\n\nb"}}|{{nindent 1 "c"}}`, "  a\n\n  b|\n c"},
+		{"join split", `{{split "," "a,b" | join "-"}} {{list 1 2 | join ","}}`, "a-b 1,2"},
+		{"default", `{{default "x" ""}} {{"y" | default "x"}} {{coalesce "" 0 "z"}}`, "x y z"},
+		{"dict", `{{(dict "a" 1 "b" (list 2 3)).b}}`, "[2 3]"},
+		{"json", `{{dict "a" (list 1 "b") | toJson}}`, `{"a":[1,"b"]}`},
+		{"yaml", `{{dict "a" (list 1 "b") | toYaml}}`, "a:\n    - 1\n    - b"},
+		{"math", `{{add 1 "2"}} {{sub 5 3}} {{mul 2 3}} {{div 7 2}} {{mod 7 2}} {{max 1 4}} {{min 1 4}}`, "3 2 6 3 1 4 1"},
+		{"hash", `{{md5 "a"}} {{sha1 "a" | len}} {{sha256 "a" | len}}`, "0cc175b9c0f1b6a831c399e269772661 40 64"},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			tmpl, err := template.New(tC.desc).Funcs(entity.FuncMap()).Parse(tC.tmpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := &bytes.Buffer{}
+			err = tmpl.Execute(buf, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tC.exp, buf.String())
+		})
+	}
+
+	tmpl := template.Must(template.New("div").Funcs(entity.FuncMap()).Parse(`{{div 1 0}}`))
+	err := tmpl.Execute(&bytes.Buffer{}, nil)
+	assert.ErrorContains(t, err, "division by zero")
+}
+
+func TestRegisterFuncs(t *testing.T) {
+	entity.RegisterFuncs(template.FuncMap{
+		"shout": func(s string) string { return strings.ToUpper(s) + "!" },
+	})
+
+	tmpl, err := template.New("a").Funcs(entity.FuncMap()).Parse(`{{shout "a"}} {{snake "aB"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "A! a_b", buf.String())
+}
+
+func TestFuncMapInParent(t *testing.T) {
+	if err := os.MkdirAll("testing", 0755); err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll("testing")
+
+	c := []byte(`{{define "name"}}{{.Vars.name | snake}}{{end}}`)
+	if err := ioutil.WriteFile("testing/a.ext", c, 0644); err != nil {
+		t.Error(err)
+	}
+
+	c = []byte(`{{template "name" .}} {{.Vars.name | pascal | plural}}`)
+	if err := ioutil.WriteFile("testing/b.ext", c, 0644); err != nil {
+		t.Error(err)
+	}
+
+	f := bytes.NewBufferString(`{
+		"name": "abc",
+		"vars": {"name": "user account"},
+		"mappings": [
+			{"start": "file:a.ext", "end": "file:b.ext"}
+		],
+		"files": {
+			"a.ext": {},
+			"b.ext": {}
+		}
+	}`)
+
+	e := &entity.Basic{Detect: state.New()}
+	err := e.Load(f)
+	if err != nil {
+		t.Error("loading config")
+	}
+
+	rm := refmap.Start()
+
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, refmap.ContextKey("orig"), "testing")
+	ctx = context.WithValue(ctx, refmap.ContextKey("dest"), "testing/out")
+
+	err = e.Process(&entity.Branch{}, rm, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = rm.Evaluate()
+	if err != nil {
+		t.Error("error evaluating refmap", err)
+	}
+
+	for _, ref := range rm.Nodes() {
+		if ref.Identifier() != "file:b.ext" {
+			continue
+		}
+		out, err := ref.(*entity.File).Render(rm, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "user_account UserAccounts", strings.TrimSpace(out.String()))
+	}
+}
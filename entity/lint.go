@@ -0,0 +1,180 @@
+package entity
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/oligoden/meta/refmap"
+)
+
+// Lint parses the template of the file with the templates of the parent
+// files and checks it without executing it. It reports every template
+// that is referenced but not defined and every field, such as .Vars.name
+// or $.Vars.name, that is not in the data of the file. Copied files are
+// not checked, nor are files of engines other than text and html.
+func (file *File) Lint(rm refmap.Grapher, ctx context.Context) []error {
+	if strings.Contains(file.Opts, "copy") {
+		return nil
+	}
+
+	// only the syntax of text/template, also used by html/template, is
+	// known
+	_, name, err := file.engine()
+	if err != nil {
+		return []error{err}
+	}
+	if name != EngineText && name != EngineHTML {
+		return nil
+	}
+
+	tmpl, err := file.template(rm, ctx)
+	if err != nil {
+		return []error{err}
+	}
+
+	l := &linter{tmpl: tmpl, visited: map[string]bool{}}
+	l.template(tmpl.Name(), reflect.ValueOf(file.Branch))
+	return l.errs
+}
+
+type linter struct {
+	tmpl *template.Template
+	root reflect.Value
+	tree *parse.Tree
+	errs []error
+	// visited holds the templates checked, with and without a known dot
+	visited map[string]bool
+}
+
+// template checks the named template with dot set to the data.
+func (l *linter) template(name string, dot reflect.Value) {
+	key := fmt.Sprintf("%s %t", name, dot.IsValid())
+	if l.visited[key] {
+		return
+	}
+	l.visited[key] = true
+
+	t := l.tmpl.Lookup(name)
+	if t == nil || t.Tree == nil || t.Tree.Root == nil {
+		return
+	}
+	// $ is the data passed to the template
+	tree, root := l.tree, l.root
+	l.tree, l.root = t.Tree, dot
+	l.walk(t.Tree.Root, dot)
+	l.tree, l.root = tree, root
+}
+
+func (l *linter) errorf(n parse.Node, format string, args ...interface{}) {
+	location, _ := l.tree.ErrorContext(n)
+	l.errs = append(l.errs, fmt.Errorf("template: %s: %s", location, fmt.Sprintf(format, args...)))
+}
+
+// walk checks the node with dot set to the data. Dot is invalid inside
+// range and with, where it is not known without executing.
+func (l *linter) walk(n parse.Node, dot reflect.Value) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			l.walk(c, dot)
+		}
+	case *parse.ActionNode:
+		l.walk(n.Pipe, dot)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			l.walk(c, dot)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			l.walk(a, dot)
+		}
+	case *parse.IfNode:
+		l.walk(n.Pipe, dot)
+		l.walk(n.List, dot)
+		l.walk(n.ElseList, dot)
+	case *parse.RangeNode:
+		l.walk(n.Pipe, dot)
+		l.walk(n.List, reflect.Value{})
+		l.walk(n.ElseList, dot)
+	case *parse.WithNode:
+		l.walk(n.Pipe, dot)
+		l.walk(n.List, reflect.Value{})
+		l.walk(n.ElseList, dot)
+	case *parse.TemplateNode:
+		if l.tmpl.Lookup(n.Name) == nil {
+			l.errorf(n, "template %q is not defined", n.Name)
+			return
+		}
+		l.walk(n.Pipe, dot)
+		// the dot of the template is only known when passed on as is
+		if n.Pipe != nil && len(n.Pipe.Cmds) == 1 && len(n.Pipe.Cmds[0].Args) == 1 {
+			if _, ok := n.Pipe.Cmds[0].Args[0].(*parse.DotNode); ok {
+				l.template(n.Name, dot)
+				return
+			}
+		}
+		l.template(n.Name, reflect.Value{})
+	case *parse.FieldNode:
+		l.field(n, dot, n.Ident)
+	case *parse.VariableNode:
+		// only $ is known, other variables are set while executing
+		if n.Ident[0] == "$" {
+			l.field(n, l.root, n.Ident[1:])
+		}
+	}
+}
+
+// field checks that the fields, methods and map keys are found in the
+// value.
+func (l *linter) field(n parse.Node, v reflect.Value, idents []string) {
+	for _, ident := range idents {
+		if !v.IsValid() {
+			return
+		}
+		for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return
+			}
+			if v.Kind() == reflect.Ptr && v.MethodByName(ident).IsValid() {
+				// the result of a method is not known
+				return
+			}
+			v = v.Elem()
+		}
+		if v.MethodByName(ident).IsValid() {
+			return
+		}
+
+		switch v.Kind() {
+		case reflect.Struct:
+			f := v.FieldByName(ident)
+			if !f.IsValid() {
+				l.errorf(n, "can't evaluate field %s in type %s", ident, v.Type())
+				return
+			}
+			v = f
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return
+			}
+			e := v.MapIndex(reflect.ValueOf(ident).Convert(v.Type().Key()))
+			if !e.IsValid() {
+				l.errorf(n, "map has no entry for key %q", ident)
+				return
+			}
+			v = e
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package entity
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/oligoden/meta/glob"
+)
+
+// Pattern matches node identifiers in mappings. It is given as a single
+// expression or a list of expressions, each in one of the forms:
+//
+//	re:<expr>    a regular expression, matched unanchored
+//	glob:<glob>  a path glob where ** matches across directories
+//	<legacy>     an anchored pattern where only * and . are special
+//
+// An expression prefixed with ! excludes the identifiers it matches.
+// An identifier matches when it matches any of the including expressions
+// (or there are none) and none of the excluding expressions.
+// The expressions are compiled when the mapping is processed so that
+// errors are reported against the location of the mapping, or else when
+// the pattern is first matched.
+type Pattern struct {
+	Exprs    []string
+	include  []*regexp.Regexp
+	exclude  []*regexp.Regexp
+	compiled bool
+}
+
+func (p *Pattern) UnmarshalJSON(data []byte) error {
+	var expr string
+	if err := json.Unmarshal(data, &expr); err == nil {
+		*p = Pattern{Exprs: []string{expr}}
+		return nil
+	}
+
+	exprs := []string{}
+	if err := json.Unmarshal(data, &exprs); err != nil {
+		return fmt.Errorf("pattern must be a string or a list of strings")
+	}
+	*p = Pattern{Exprs: exprs}
+	return nil
+}
+
+func (p Pattern) MarshalJSON() ([]byte, error) {
+	if len(p.Exprs) == 1 {
+		return json.Marshal(p.Exprs[0])
+	}
+	return json.Marshal(p.Exprs)
+}
+
+// ParsePattern compiles the expressions into a pattern.
+func ParsePattern(exprs ...string) (*Pattern, error) {
+	p := &Pattern{Exprs: exprs}
+	err := p.Compile()
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Compile compiles the expressions of the pattern.
+func (p *Pattern) Compile() error {
+	p.include = nil
+	p.exclude = nil
+	p.compiled = false
+
+	for _, expr := range p.Exprs {
+		negate := strings.HasPrefix(expr, "!")
+		expr := strings.TrimPrefix(expr, "!")
+
+		var search string
+		switch {
+		case strings.HasPrefix(expr, "re:"):
+			search = strings.TrimPrefix(expr, "re:")
+		case strings.HasPrefix(expr, "glob:"):
+			var err error
+			search, err = glob.Regexp(strings.TrimPrefix(expr, "glob:"))
+			if err != nil {
+				return fmt.Errorf("pattern %q, %w", expr, err)
+			}
+		default:
+			search = legacyRegexp(expr)
+		}
+
+		re, err := regexp.Compile(search)
+		if err != nil {
+			return fmt.Errorf("pattern %q, %w", expr, err)
+		}
+
+		if negate {
+			p.exclude = append(p.exclude, re)
+		} else {
+			p.include = append(p.include, re)
+		}
+	}
+
+	p.compiled = true
+	return nil
+}
+
+// MatchString reports whether the identifier matches the pattern. The
+// pattern is compiled if it was not yet, where a pattern that does not
+// compile or has no expressions matches nothing.
+func (p *Pattern) MatchString(s string) bool {
+	if !p.compiled && p.Compile() != nil {
+		return false
+	}
+	if p.include == nil && p.exclude == nil {
+		return false
+	}
+
+	for _, re := range p.exclude {
+		if re.MatchString(s) {
+			return false
+		}
+	}
+
+	if len(p.include) == 0 {
+		return true
+	}
+	for _, re := range p.include {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func legacyRegexp(search string) string {
+	search = fmt.Sprintf("^%s$", search)
+	search = strings.ReplaceAll(search, `.`, `\.`)
+	search = strings.ReplaceAll(search, `*`, `.*`)
+	return search
+}
+
+// Regexp is a legacy mapping pattern where only * and . are special.
+//
+// Deprecated: Use Pattern, which also supports regular expressions, globs
+// and exclusions.
+type Regexp struct {
+	regexp.Regexp
+}
+
+func (r *Regexp) UnmarshalText(text []byte) error {
+	rr, err := Compile(legacyRegexp(string(text)))
+	if err != nil {
+		return err
+	}
+	*r = *rr
+	return nil
+}
+
+// Compile compiles the regular expression into a Regexp.
+//
+// Deprecated: Use ParsePattern with a "re:" expression.
+func Compile(expr string) (*Regexp, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Regexp{*re}, nil
+}
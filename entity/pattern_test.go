@@ -0,0 +1,145 @@
+package entity_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/oligoden/meta/entity"
+	"github.com/oligoden/meta/entity/state"
+	"github.com/oligoden/meta/refmap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatternMatch(t *testing.T) {
+	tests := []struct {
+		exprs []string
+		match []string
+		miss  []string
+	}{
+		{
+			exprs: []string{"file:*.go"},
+			match: []string{"file:a.go", "file:a/b.go"},
+			miss:  []string{"file:a.goo", "file:a_go"},
+		},
+		{
+			exprs: []string{"re:^file:[ab]\\.go$"},
+			match: []string{"file:a.go", "file:b.go"},
+			miss:  []string{"file:c.go"},
+		},
+		{
+			exprs: []string{"glob:file:src/*.go"},
+			match: []string{"file:src/a.go"},
+			miss:  []string{"file:src/a/b.go", "file:a.go"},
+		},
+		{
+			exprs: []string{"glob:file:src/**/*.go"},
+			match: []string{"file:src/a.go", "file:src/a/b.go", "file:src/a/b/c.go"},
+			miss:  []string{"file:a.go"},
+		},
+		{
+			exprs: []string{"glob:file:{a,b}.[!c]xt"},
+			match: []string{"file:a.ext", "file:b.ext"},
+			miss:  []string{"file:c.ext", "file:a.cxt"},
+		},
+		{
+			exprs: []string{"glob:file:**/*.go", "!glob:file:**/*_test.go"},
+			match: []string{"file:a.go", "file:a/b.go"},
+			miss:  []string{"file:a_test.go", "file:a/b_test.go"},
+		},
+		{
+			exprs: []string{"!exec:*"},
+			match: []string{"file:a.go"},
+			miss:  []string{"exec:gen"},
+		},
+	}
+
+	for _, test := range tests {
+		p, err := entity.ParsePattern(test.exprs...)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		for _, s := range test.match {
+			assert.True(t, p.MatchString(s), fmt.Sprintf("%v should match %s", test.exprs, s))
+		}
+		for _, s := range test.miss {
+			assert.False(t, p.MatchString(s), fmt.Sprintf("%v should not match %s", test.exprs, s))
+		}
+	}
+
+	_, err := entity.ParsePattern("glob:file:{a,b")
+	assert.Error(t, err)
+
+	assert.False(t, (&entity.Pattern{}).MatchString(""))
+
+	// patterns that were not compiled are compiled when matched
+	p := &entity.Pattern{Exprs: []string{"glob:file:**/*.go"}}
+	assert.True(t, p.MatchString("file:a/b.go"))
+	p = &entity.Pattern{Exprs: []string{"re:("}}
+	assert.False(t, p.MatchString("file:a.go"))
+
+	r := &entity.Regexp{}
+	assert.NoError(t, r.UnmarshalText([]byte("file:*.go")))
+	assert.True(t, r.MatchString("file:a.go"))
+	_, err = entity.Compile("(")
+	assert.Error(t, err)
+}
+
+func TestPatternMapping(t *testing.T) {
+	f := bytes.NewBufferString(`{
+		"name": "abc",
+		"dirs": {
+			"a": {
+				"mappings": [
+					{"start": ["glob:file:a/*.ext", "!glob:file:a/[cd].ext"], "end": "re:^file:a/d"}
+				],
+				"files": {
+					"a.ext": {},
+					"b.ext": {},
+					"c.ext": {},
+					"d.ext": {}
+				}
+			}
+		}
+	}`)
+
+	e := &entity.Basic{Detect: state.New()}
+	err := e.Load(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rm := refmap.Start()
+
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, refmap.ContextKey("orig"), "testing")
+	ctx = context.WithValue(ctx, refmap.ContextKey("dest"), "testing/out")
+	ctx = context.WithValue(ctx, refmap.ContextKey("verbose"), 0)
+
+	err = e.Process(&entity.Branch{}, rm, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, rm.Evaluate())
+
+	assert.ElementsMatch(t, []string{"file:a/d.ext", "file:a/a.ext", "file:a/b.ext"}, rm.ParentFiles("file:a/d.ext"))
+
+	f = bytes.NewBufferString(`{
+		"name": "abc",
+		"mappings": [
+			{"start": "re:file:(", "end": "file:b.ext"}
+		]
+	}`)
+
+	e = &entity.Basic{Detect: state.New()}
+	err = e.Load(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = e.Process(&entity.Branch{}, refmap.Start(), ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `mappings[0] in basic:abc, start pattern "re:file:("`)
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
+	"text/template"
 
 	"github.com/oligoden/meta/entity/state"
+	"github.com/oligoden/meta/helper"
 	"github.com/oligoden/meta/refmap"
 )
 
@@ -19,11 +22,13 @@ func NewProject() *Project {
 }
 
 type Project struct {
-	Testing      bool       `json:"testing"`
-	Environment  string     `json:"environment"`
-	Repository   Repository `json:"repo"`
-	OrigLocation string     `json:"orig"`
-	DestLocation string     `json:"dest"`
+	Testing      bool                     `json:"testing"`
+	Environment  string                   `json:"environment"`
+	Repository   Repository               `json:"repo"`
+	OrigLocation string                   `json:"orig"`
+	DestLocation string                   `json:"dest"`
+	Watch        Watch                    `json:"watch"`
+	Helpers      map[string]helper.Config `json:"helpers"`
 	oldName      string
 	Basic
 }
@@ -31,6 +36,15 @@ type Project struct {
 type Repository struct {
 }
 
+// Watch configures how meta up watches the sources. Polling is used on
+// file systems that do not deliver notifications, with the interval in
+// milliseconds and optionally comparing the contents of files.
+type Watch struct {
+	Poll     bool `json:"poll"`
+	Interval int  `json:"interval"`
+	Hash     bool `json:"hash"`
+}
+
 func (p Project) Identifier() string {
 	return "prj:" + p.Name
 }
@@ -62,10 +76,18 @@ func (e *Project) LoadFile(fn string) error {
 		return fmt.Errorf("closing file, %w", err)
 	}
 
-	fmt.Println("loaded config file")
+	slog.Debug("loaded config file", "file", fn)
 	return nil
 }
 
+// Follow carries the state of the project processed before over to the
+// project, so that a reloaded config is processed as a change of it and
+// a changed name renames the project node.
+func (e *Project) Follow(prev *Project) {
+	e.oldName = prev.oldName
+	e.Detect = state.New(prev.Hash())
+}
+
 func (e *Project) Process(bb BranchBuilder, rm refmap.Mutator, ctx context.Context) error {
 	// Check if name changed
 	if e.oldName != "" && e.oldName != e.Name {
@@ -83,6 +105,13 @@ func (e *Project) Process(bb BranchBuilder, rm refmap.Mutator, ctx context.Conte
 		e.oldName = "-"
 	}
 
+	if hs := helpers(ctx); hs != nil {
+		err := hs.Update(ctx, e.Helpers, ctx.Value(refmap.ContextKey("orig")).(string), reservedFuncs())
+		if err != nil {
+			return err
+		}
+	}
+
 	err := e.Basic.Process(bb, rm, ctx)
 	if err != nil {
 		return err
@@ -90,3 +119,20 @@ func (e *Project) Process(bb BranchBuilder, rm refmap.Mutator, ctx context.Conte
 
 	return nil
 }
+
+// reservedFuncs returns the functions that helpers may not provide, the
+// functions of FuncMap and the functions reading the project tree.
+func reservedFuncs() template.FuncMap {
+	funcs := FuncMap()
+	for name, fn := range (&tree{}).funcs() {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// helpers returns the providers of template functions in the context,
+// or nil.
+func helpers(ctx context.Context) *helper.Set {
+	hs, _ := ctx.Value(refmap.ContextKey("helpers")).(*helper.Set)
+	return hs
+}
@@ -13,6 +13,23 @@ const (
 	Remove
 )
 
+// Name returns the name of the state.
+func Name(state uint8) string {
+	switch state {
+	case Stable:
+		return "stable"
+	case Checked:
+		return "checked"
+	case Updated:
+		return "updated"
+	case Added:
+		return "added"
+	case Remove:
+		return "remove"
+	}
+	return fmt.Sprintf("unknown(%d)", state)
+}
+
 type Detect struct {
 	hash  string
 	state uint8
@@ -0,0 +1,117 @@
+package entity
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// defaultTailLines is the number of output lines kept in memory
+// for the error summary of an exec.
+const defaultTailLines = 20
+
+// maxLineBytes is the most output kept for a line that has not ended,
+// such as a progress bar or binary output. A longer line is passed on
+// in parts of this size.
+const maxLineBytes = 64 * 1024
+
+// execOutput is the shared sink of the stdout and stderr streams of
+// a running exec. Every complete line is written to the output with
+// the exec name as prefix, to the log file if one is set and kept
+// in a bounded tail.
+type execOutput struct {
+	mu     sync.Mutex
+	prefix string
+	out    io.Writer
+	log    io.Writer
+	tail   *lineTail
+	record *[]string
+}
+
+func (o *execOutput) line(l []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.out != nil {
+		o.out.Write([]byte(o.prefix))
+		o.out.Write(l)
+		o.out.Write([]byte{'\n'})
+	}
+	if o.log != nil {
+		o.log.Write(l)
+		o.log.Write([]byte{'\n'})
+	}
+	o.tail.add(string(l))
+	if o.record != nil {
+		*o.record = append(*o.record, string(l))
+	}
+}
+
+// writer returns a line splitting writer feeding the shared sink.
+// It must be flushed after the command completed to pass on a
+// trailing line without a newline.
+func (o *execOutput) writer() *lineWriter {
+	return &lineWriter{o: o}
+}
+
+type lineWriter struct {
+	o   *execOutput
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.o.line(bytes.TrimSuffix(w.buf[:i], []byte{'\r'}))
+		w.buf = w.buf[i+1:]
+	}
+	for len(w.buf) > maxLineBytes {
+		w.o.line(w.buf[:maxLineBytes])
+		w.buf = w.buf[maxLineBytes:]
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) flush() {
+	if len(w.buf) > 0 {
+		w.o.line(w.buf)
+		w.buf = nil
+	}
+}
+
+// lineTail keeps the last lines written to it.
+type lineTail struct {
+	mu    sync.Mutex
+	size  int
+	lines []string
+}
+
+func newLineTail(size int) *lineTail {
+	return &lineTail{size: size}
+}
+
+func (t *lineTail) add(l string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lines = append(t.lines, l)
+	if len(t.lines) > t.size {
+		t.lines = t.lines[len(t.lines)-t.size:]
+	}
+}
+
+// snapshot returns a copy of the lines in the tail.
+func (t *lineTail) snapshot() []string {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]string{}, t.lines...)
+}
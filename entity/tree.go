@@ -0,0 +1,171 @@
+package entity
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/oligoden/meta/entity/state"
+	"github.com/oligoden/meta/refmap"
+)
+
+// Node is a node of the project as read by templates.
+type Node struct {
+	ID string
+	// Kind is the kind of the node, such as file, dir or exec.
+	Kind string
+	Name string
+	// Path is the source path of a file or directory and Dest its
+	// destination path, both relative to the base directories. Dest is
+	// empty for files that are not output.
+	Path string
+	Dest string
+	Vars map[string]string
+}
+
+// tree reads the nodes of the project for the template of a file. The
+// nodes read are recorded as queries of the file, so that the file is
+// updated when they change or when nodes are added or removed.
+type tree struct {
+	file  *File
+	rm    refmap.Grapher
+	reads *reads
+}
+
+// treeFuncs returns the functions reading the project tree, recording
+// the queries in the reads.
+func (file *File) treeFuncs(rm refmap.Grapher, r *reads) template.FuncMap {
+	t := &tree{file: file, rm: rm, reads: r}
+	return t.funcs()
+}
+
+func (t *tree) funcs() template.FuncMap {
+	return template.FuncMap{
+		"node":     t.node,
+		"nodes":    t.nodes,
+		"files":    t.files,
+		"dirs":     t.dirs,
+		"siblings": t.siblings,
+	}
+}
+
+// node returns the node with the identifier.
+func (t *tree) node(id string) (Node, error) {
+	nodes, err := t.query(regexp.MustCompile("^" + regexp.QuoteMeta(id) + "$"))
+	if err != nil {
+		return Node{}, err
+	}
+	if len(nodes) == 0 {
+		return Node{}, fmt.Errorf("node %s not found", id)
+	}
+	return nodes[0], nil
+}
+
+// nodes returns the nodes with identifiers matching the pattern, given
+// in the forms of the patterns of mappings.
+func (t *tree) nodes(exprs ...string) ([]Node, error) {
+	p, err := ParsePattern(exprs...)
+	if err != nil {
+		return nil, err
+	}
+	return t.query(p)
+}
+
+// files returns the files in the source directory, relative to the base
+// source directory.
+func (t *tree) files(dir string) ([]Node, error) {
+	return t.query(regexp.MustCompile("^file:" + regexp.QuoteMeta(dirPrefix(dir)) + "[^/]+$"))
+}
+
+// dirs returns the directories in the source directory, relative to the
+// base source directory.
+func (t *tree) dirs(dir string) ([]Node, error) {
+	return t.query(regexp.MustCompile("^dir:" + regexp.QuoteMeta(dirPrefix(dir)) + "[^/:]+:"))
+}
+
+// siblings returns the other files in the directory of the file.
+func (t *tree) siblings() ([]Node, error) {
+	nodes, err := t.files(filepath.Dir(t.file.Source))
+	if err != nil {
+		return nil, err
+	}
+
+	siblings := []Node{}
+	for _, n := range nodes {
+		if n.ID != t.file.Identifier() {
+			siblings = append(siblings, n)
+		}
+	}
+	return siblings, nil
+}
+
+func dirPrefix(dir string) string {
+	dir = filepath.ToSlash(filepath.Clean(dir))
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return strings.TrimPrefix(dir, "/") + "/"
+}
+
+// query records the matcher as a query of the file and returns the
+// matching nodes sorted by identifier. Nodes set for removal are left
+// out.
+func (t *tree) query(m refmap.Matcher) ([]Node, error) {
+	if t.rm == nil {
+		return nil, fmt.Errorf("the project tree is not available")
+	}
+
+	t.reads.matchers = append(t.reads.matchers, m)
+
+	nodes := []Node{}
+	for _, ref := range t.rm.Nodes() {
+		if !m.MatchString(ref.Identifier()) || ref.State() == state.Remove {
+			continue
+		}
+		nodes = append(nodes, newNode(ref))
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID < nodes[j].ID
+	})
+	return nodes, nil
+}
+
+func newNode(ref refmap.Actioner) Node {
+	kind, _, _ := strings.Cut(ref.Identifier(), ":")
+	n := Node{
+		ID:   ref.Identifier(),
+		Kind: kind,
+		Vars: map[string]string{},
+	}
+
+	vars := map[string]string{}
+	switch v := ref.(type) {
+	case *File:
+		n.Name = v.Name
+		n.Path = v.Source
+		if strings.Contains(v.Opts, "output") {
+			n.Dest = v.dest()
+		}
+		vars = v.Vars
+	case *Directory:
+		n.Name = v.Name
+		n.Path = v.SrcDerived
+		n.Dest = v.DstDerived
+		vars = v.Vars
+	case *Project:
+		n.Name = v.Name
+		vars = v.Vars
+	case *Basic:
+		n.Name = v.Name
+		vars = v.Vars
+	case *CLE:
+		n.Name = v.Name
+	}
+	for k, val := range vars {
+		n.Vars[k] = val
+	}
+	return n
+}
@@ -0,0 +1,108 @@
+package entity_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/oligoden/meta/entity"
+	"github.com/oligoden/meta/entity/state"
+	"github.com/oligoden/meta/refmap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTree(t *testing.T) {
+	assert := assert.New(t)
+
+	if err := os.MkdirAll("testing/handlers", 0755); err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll("testing")
+
+	files := map[string]string{
+		"handlers/a.go": `{{range siblings}}{{.Name}}{{end}}`,
+		"handlers/b.go": ``,
+		"index.go":      `{{range files "handlers"}}{{.Name}}:{{.Vars.route}}:{{.Dest}} {{end}}{{range dirs "."}}{{.Path}} {{end}}{{(node "basic:abc").Name}} {{len (nodes "glob:file:**")}}`,
+	}
+	for name, c := range files {
+		if err := ioutil.WriteFile("testing/"+name, []byte(c), 0644); err != nil {
+			t.Error(err)
+		}
+	}
+
+	f := bytes.NewBufferString(`{
+		"name": "abc",
+		"files": {
+			"index.go": {"options": "output"}
+		},
+		"dirs": {
+			"handlers": {
+				"options": "output",
+				"files": {
+					"a.go": {"vars": {"route": "/a"}},
+					"b.go": {"vars": {"route": "/b"}}
+				}
+			}
+		}
+	}`)
+
+	e := &entity.Basic{Detect: state.New()}
+	err := e.Load(f)
+	if err != nil {
+		t.Error("loading config")
+	}
+
+	rm := refmap.Start()
+
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, refmap.ContextKey("orig"), "testing")
+	ctx = context.WithValue(ctx, refmap.ContextKey("dest"), "testing/out")
+
+	err = e.Process(&entity.Branch{}, rm, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = rm.Evaluate()
+	if err != nil {
+		t.Error("error evaluating refmap", err)
+	}
+
+	rendered := map[string]string{}
+	for _, ref := range rm.Nodes() {
+		if file, ok := ref.(*entity.File); ok {
+			out, err := file.Render(rm, ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rendered[ref.Identifier()] = out.String()
+		}
+	}
+	assert.Equal("b.go", rendered["file:handlers/a.go"])
+	assert.Equal("a.go:/a:handlers/a.go b.go:/b:handlers/b.go handlers abc 3", rendered["file:index.go"])
+	rm.Finish()
+
+	// rendering does not change the graph
+	rm.SetUpdate("file:handlers/b.go", "fs write")
+	rm.Propagate()
+	assert.Nil(rm.Cause("file:index.go"))
+	rm.Finish()
+
+	for _, ref := range rm.Nodes() {
+		if file, ok := ref.(*entity.File); ok {
+			err := file.Perform(rm, ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	rm.Finish()
+
+	// the nodes read while building are dependencies of the file
+	rm.SetUpdate("file:handlers/b.go", "fs write")
+	rm.Propagate()
+	assert.Equal([]string{"file:index.go", "file:handlers/b.go", "fs write"}, rm.Cause("file:index.go"))
+	assert.Equal([]string{"file:handlers/a.go", "file:handlers/b.go", "fs write"}, rm.Cause("file:handlers/a.go"))
+}
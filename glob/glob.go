@@ -0,0 +1,87 @@
+// Package glob translates path globs into regular expressions.
+package glob
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Regexp translates a path glob into an anchored regular expression.
+// A * matches within a path segment, ** matches across segments,
+// ? matches a single character, [...] a character class
+// ([!...] negated) and {a,b} one of the alternatives.
+func Regexp(glob string) (string, error) {
+	b := &strings.Builder{}
+	b.WriteString("^")
+
+	braces := 0
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated character class")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case '{':
+			braces++
+			b.WriteString("(?:")
+		case '}':
+			if braces == 0 {
+				return "", fmt.Errorf("unmatched }")
+			}
+			braces--
+			b.WriteString(")")
+		case ',':
+			if braces > 0 {
+				b.WriteString("|")
+			} else {
+				b.WriteString(",")
+			}
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	if braces > 0 {
+		return "", fmt.Errorf("unterminated {")
+	}
+
+	b.WriteString("$")
+	return b.String(), nil
+}
+
+// Compile compiles a path glob.
+func Compile(glob string) (*regexp.Regexp, error) {
+	search, err := Regexp(glob)
+	if err != nil {
+		return nil, err
+	}
+	return regexp.Compile(search)
+}
@@ -0,0 +1,43 @@
+package glob_test
+
+import (
+	"testing"
+
+	"github.com/oligoden/meta/glob"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		glob  string
+		match []string
+		miss  []string
+	}{
+		{"*.go", []string{"a.go"}, []string{"a/b.go", "a.gox"}},
+		{"**/*.go", []string{"a.go", "a/b.go", "a/b/c.go"}, []string{"a.txt"}},
+		{"a/**", []string{"a/b", "a/b/c"}, []string{"a", "b/a"}},
+		{"a/**/b", []string{"a/b", "a/x/b", "a/x/y/b"}, []string{"a/xb"}},
+		{"?.[a-c]", []string{"x.a", "y.c"}, []string{"xy.a", "x.d"}},
+		{"[!x].go", []string{"a.go"}, []string{"x.go"}},
+		{"*.{js,ts}", []string{"a.js", "a.ts"}, []string{"a.go"}},
+		{`\*.go`, []string{"*.go"}, []string{"a.go"}},
+	}
+
+	for _, test := range tests {
+		re, err := glob.Compile(test.glob)
+		if !assert.NoError(t, err, test.glob) {
+			continue
+		}
+		for _, s := range test.match {
+			assert.True(t, re.MatchString(s), test.glob+" should match "+s)
+		}
+		for _, s := range test.miss {
+			assert.False(t, re.MatchString(s), test.glob+" should not match "+s)
+		}
+	}
+
+	for _, bad := range []string{"[a", "{a,b", "a}"} {
+		_, err := glob.Compile(bad)
+		assert.Error(t, err, bad)
+	}
+}
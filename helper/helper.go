@@ -0,0 +1,422 @@
+// Package helper runs external executables that provide template
+// functions. A provider is started once and kept running, reading
+// requests from its standard input and writing responses to its standard
+// output, one JSON object per line.
+//
+// The first request asks for the names of the functions:
+//
+//	{"id":0,"method":"funcs","args":[]}
+//	{"id":0,"result":["tableName","columnType"]}
+//
+// Every use of a function in a template is then a call:
+//
+//	{"id":1,"method":"call","func":"tableName","args":["user"]}
+//	{"id":1,"result":"users"}
+//
+// A call fails with the error of the response if it is not empty. The
+// names of the functions must be valid template identifiers. A provider
+// that does not respond within the timeout is killed. The provider should
+// exit when its standard input is closed.
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// Config configures a provider like an exec, with the command and its
+// arguments, the environment variables added, the working directory
+// relative to the origin directory and the time in milliseconds to wait
+// for a response, 5000 by default.
+type Config struct {
+	Cmd     []string          `json:"cmd"`
+	Env     map[string]string `json:"env"`
+	Dir     string            `json:"dir"`
+	Timeout uint              `json:"timeout"`
+}
+
+// defaultTimeout is the time to wait for a response when the config
+// sets none.
+const defaultTimeout = 5000
+
+type request struct {
+	ID     int           `json:"id"`
+	Method string        `json:"method"`
+	Func   string        `json:"func,omitempty"`
+	Args   []interface{} `json:"args"`
+}
+
+type response struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  string          `json:"error"`
+	// err is set when the line could not be decoded
+	err error
+}
+
+// Provider is a running provider.
+type Provider struct {
+	name    string
+	cmd     *exec.Cmd
+	in      io.WriteCloser
+	timeout time.Duration
+
+	// responses are read from the standard output until it is closed,
+	// after which readErr holds the error
+	responses chan response
+	readErr   error
+	done      chan struct{}
+
+	mu    sync.Mutex
+	id    int
+	funcs []string
+	// err is set when the provider was killed
+	err error
+}
+
+// Start starts the provider in the origin directory and asks for its
+// functions.
+func Start(ctx context.Context, name string, c Config, origLocation string) (*Provider, error) {
+	if len(c.Cmd) == 0 {
+		return nil, fmt.Errorf("helper %s has no cmd", name)
+	}
+
+	cmd := exec.Command(c.Cmd[0], c.Cmd[1:]...)
+	cmd.Dir = filepath.Join(origLocation, c.Dir)
+	cmd.Stderr = os.Stderr
+	if len(c.Env) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range c.Env {
+			cmd.Env = append(cmd.Env, fmt.Sprintf(`%s=%s`, k, v))
+		}
+	}
+
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("helper %s, %w", name, err)
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("helper %s, %w", name, err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("starting helper %s, %w", name, err)
+	}
+
+	if c.Timeout == 0 {
+		c.Timeout = defaultTimeout
+	}
+	p := &Provider{
+		name:      name,
+		cmd:       cmd,
+		in:        in,
+		timeout:   time.Duration(c.Timeout) * time.Millisecond,
+		responses: make(chan response),
+		done:      make(chan struct{}),
+	}
+	go p.read(out)
+
+	result, err := p.request(ctx, request{Method: "funcs", Args: []interface{}{}})
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	err = json.Unmarshal(result, &p.funcs)
+	if err != nil {
+		p.Close()
+		return nil, fmt.Errorf("decoding functions of helper %s, %w", name, err)
+	}
+	for _, fn := range p.funcs {
+		if !identifier(fn) {
+			p.Close()
+			return nil, fmt.Errorf("helper %s provides function %q, which is not a valid name", name, fn)
+		}
+	}
+	return p, nil
+}
+
+// identifier reports whether the name is a valid name of a template
+// function, as adding an invalid name to a template panics.
+func identifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i > 0 && unicode.IsDigit(r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// read reads the responses from the standard output of the provider.
+func (p *Provider) read(out io.Reader) {
+	defer close(p.responses)
+
+	r := bufio.NewReader(out)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			p.readErr = err
+			return
+		}
+		res := response{}
+		err = json.Unmarshal(line, &res)
+		if err != nil {
+			res.err = err
+		}
+		select {
+		case p.responses <- res:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// request sends the request and waits for its response. A provider that
+// does not respond within the timeout is killed. When the context is
+// cancelled the request is given up and its response skipped later.
+func (p *Provider) request(ctx context.Context, req request) (json.RawMessage, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	req.ID = p.id
+	p.id++
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("encoding request to helper %s, %w", p.name, err)
+	}
+	_, err = p.in.Write(append(b, '\n'))
+	if err != nil {
+		return nil, fmt.Errorf("writing to helper %s, %w", p.name, err)
+	}
+
+	timeout := time.NewTimer(p.timeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case res, ok := <-p.responses:
+			if !ok {
+				return nil, fmt.Errorf("reading from helper %s, %w", p.name, p.readErr)
+			}
+			if res.err != nil {
+				return nil, fmt.Errorf("decoding response of helper %s, %w", p.name, res.err)
+			}
+			if res.ID < req.ID {
+				// the response to a request that was given up
+				continue
+			}
+			if res.ID != req.ID {
+				return nil, fmt.Errorf("helper %s responded to request %d, expected %d", p.name, res.ID, req.ID)
+			}
+			if res.Error != "" {
+				return nil, fmt.Errorf("helper %s, %s", p.name, res.Error)
+			}
+			return res.Result, nil
+		case <-ctx.Done():
+			return nil, fmt.Errorf("helper %s, %w", p.name, ctx.Err())
+		case <-timeout.C:
+			p.cmd.Process.Kill()
+			p.err = fmt.Errorf("helper %s did not respond within %s and was killed", p.name, p.timeout)
+			return nil, p.err
+		}
+	}
+}
+
+// killed reports whether the provider was killed for not responding.
+func (p *Provider) killed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err != nil
+}
+
+// Call calls the function of the provider. Numbers in the result are
+// json.Number values.
+func (p *Provider) Call(ctx context.Context, fn string, args ...interface{}) (interface{}, error) {
+	if args == nil {
+		args = []interface{}{}
+	}
+	result, err := p.request(ctx, request{Method: "call", Func: fn, Args: args})
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	if len(result) == 0 {
+		return v, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(result))
+	dec.UseNumber()
+	err = dec.Decode(&v)
+	if err != nil {
+		return nil, fmt.Errorf("decoding result of %s from helper %s, %w", fn, p.name, err)
+	}
+	return v, nil
+}
+
+// Funcs returns the functions of the provider, which call it with the
+// context.
+func (p *Provider) Funcs(ctx context.Context) template.FuncMap {
+	funcs := template.FuncMap{}
+	for _, fn := range p.funcs {
+		fn := fn
+		funcs[fn] = func(args ...interface{}) (interface{}, error) {
+			return p.Call(ctx, fn, args...)
+		}
+	}
+	return funcs
+}
+
+// Close closes the standard input of the provider and waits for it to
+// exit, killing it if it does not exit within a second.
+func (p *Provider) Close() error {
+	close(p.done)
+	p.in.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- p.cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second):
+		p.cmd.Process.Kill()
+		return <-done
+	}
+}
+
+// Set is the running providers of a project. A nil set provides no
+// functions.
+type Set struct {
+	mu        sync.Mutex
+	configs   map[string]Config
+	providers map[string]*Provider
+}
+
+// NewSet returns an empty set.
+func NewSet() *Set {
+	return &Set{
+		configs:   map[string]Config{},
+		providers: map[string]*Provider{},
+	}
+}
+
+// Update starts the providers that are new, changed or were killed and
+// stops the providers that are removed or changed. Two providers may not
+// provide the same function and no provider may provide one of the
+// reserved functions. A provider failing these checks is stopped.
+func (s *Set) Update(ctx context.Context, configs map[string]Config, origLocation string, reserved template.FuncMap) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, p := range s.providers {
+		if c, ok := configs[name]; ok && reflect.DeepEqual(c, s.configs[name]) && !p.killed() {
+			continue
+		}
+		s.stop(name)
+	}
+
+	names := []string{}
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := s.providers[name]; ok {
+			continue
+		}
+		p, err := Start(ctx, name, configs[name], origLocation)
+		if err != nil {
+			return err
+		}
+		s.providers[name] = p
+		s.configs[name] = configs[name]
+	}
+
+	provided := map[string]string{}
+	for _, name := range names {
+		for _, fn := range s.providers[name].funcs {
+			if _, ok := reserved[fn]; ok {
+				s.stop(name)
+				return fmt.Errorf("helper %s provides function %s, which is a builtin function", name, fn)
+			}
+			if other, ok := provided[fn]; ok {
+				s.stop(name)
+				return fmt.Errorf("function %s is provided by helpers %s and %s", fn, other, name)
+			}
+			provided[fn] = name
+		}
+	}
+	return nil
+}
+
+// stop stops the provider and removes it from the set.
+func (s *Set) stop(name string) {
+	s.providers[name].Close()
+	delete(s.providers, name)
+	delete(s.configs, name)
+}
+
+// Funcs returns the functions of all providers, which call them with the
+// context.
+func (s *Set) Funcs(ctx context.Context) template.FuncMap {
+	funcs := template.FuncMap{}
+	if s == nil {
+		return funcs
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.providers {
+		for name, fn := range p.Funcs(ctx) {
+			funcs[name] = fn
+		}
+	}
+	return funcs
+}
+
+// Close stops all providers.
+func (s *Set) Close() error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for name, p := range s.providers {
+		if e := p.Close(); e != nil && err == nil {
+			err = fmt.Errorf("stopping helper %s, %w", name, e)
+		}
+		delete(s.providers, name)
+		delete(s.configs, name)
+	}
+	return err
+}
@@ -0,0 +1,187 @@
+package helper_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/oligoden/meta/helper"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestProvider is not a test but the provider run by the tests.
+func TestProvider(t *testing.T) {
+	if os.Getenv("META_TEST_PROVIDER") == "" {
+		return
+	}
+
+	funcs := strings.Split(os.Getenv("META_TEST_PROVIDER"), ",")
+	scanner := bufio.NewScanner(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+	for scanner.Scan() {
+		req := struct {
+			ID     int
+			Method string
+			Func   string
+			Args   []interface{}
+		}{}
+		json.Unmarshal(scanner.Bytes(), &req)
+
+		switch {
+		case req.Method == "funcs":
+			enc.Encode(map[string]interface{}{"id": req.ID, "result": funcs})
+		case req.Func == "fail":
+			enc.Encode(map[string]interface{}{"id": req.ID, "error": "failed"})
+		case req.Func == "hang":
+			// never responds
+		case req.Func == "slow":
+			time.Sleep(200 * time.Millisecond)
+			enc.Encode(map[string]interface{}{"id": req.ID, "result": "slow"})
+		default:
+			enc.Encode(map[string]interface{}{"id": req.ID, "result": []interface{}{req.Func, req.Args}})
+		}
+	}
+	os.Exit(0)
+}
+
+func provider(funcs string) helper.Config {
+	return helper.Config{
+		Cmd: []string{os.Args[0], "-test.run=^TestProvider$"},
+		Env: map[string]string{"META_TEST_PROVIDER": funcs},
+	}
+}
+
+func TestProviderFuncs(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	p, err := helper.Start(ctx, "test", provider("echo,fail"), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	tmpl, err := template.New("a").Funcs(p.Funcs(ctx)).Parse(`{{echo "a" 1}} {{echo}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	assert.NoError(tmpl.Execute(buf, nil))
+	assert.Equal("[echo [a 1]] [echo []]", buf.String())
+
+	_, err = p.Call(ctx, "fail")
+	assert.EqualError(err, "helper test, failed")
+}
+
+func TestProviderNames(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	_, err := helper.Start(ctx, "test", provider("echo,to-upper"), ".")
+	assert.EqualError(err, `helper test provides function "to-upper", which is not a valid name`)
+
+	_, err = helper.Start(ctx, "test", provider("1st"), ".")
+	assert.EqualError(err, `helper test provides function "1st", which is not a valid name`)
+
+	p, err := helper.Start(ctx, "test", provider("_a1,ünï"), ".")
+	if assert.NoError(err) {
+		p.Close()
+	}
+}
+
+func TestProviderTimeout(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	c := provider("hang,slow,echo")
+	c.Timeout = 100
+	p, err := helper.Start(ctx, "test", c, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// a cancelled call is given up and its response skipped
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = p.Call(cctx, "slow")
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+	time.Sleep(250 * time.Millisecond)
+	v, err := p.Call(ctx, "echo")
+	assert.NoError(err)
+	assert.Equal([]interface{}{"echo", []interface{}{}}, v)
+
+	_, err = p.Call(ctx, "hang")
+	assert.EqualError(err, "helper test did not respond within 100ms and was killed")
+	_, err = p.Call(ctx, "echo")
+	assert.EqualError(err, "helper test did not respond within 100ms and was killed")
+}
+
+func TestSet(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	s := helper.NewSet()
+	defer s.Close()
+
+	err := s.Update(ctx, map[string]helper.Config{
+		"a": provider("one"),
+		"b": provider("two"),
+	}, ".", nil)
+	assert.NoError(err)
+	assert.Contains(s.Funcs(ctx), "one")
+	assert.Contains(s.Funcs(ctx), "two")
+
+	err = s.Update(ctx, map[string]helper.Config{"a": provider("one")}, ".", nil)
+	assert.NoError(err)
+	assert.Contains(s.Funcs(ctx), "one")
+	assert.NotContains(s.Funcs(ctx), "two")
+
+	err = s.Update(ctx, map[string]helper.Config{
+		"a": provider("one"),
+		"c": provider("one"),
+	}, ".", nil)
+	assert.EqualError(err, "function one is provided by helpers a and c")
+	assert.Contains(s.Funcs(ctx), "one")
+
+	err = s.Update(ctx, map[string]helper.Config{
+		"a": provider("one"),
+		"d": provider("upper"),
+	}, ".", template.FuncMap{"upper": strings.ToUpper})
+	assert.EqualError(err, "helper d provides function upper, which is a builtin function")
+	assert.NotContains(s.Funcs(ctx), "upper")
+
+	_, err = helper.Start(ctx, "none", helper.Config{}, ".")
+	assert.Error(err)
+
+	var none *helper.Set
+	assert.Empty(none.Funcs(ctx))
+}
+
+func TestSetRestart(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	s := helper.NewSet()
+	defer s.Close()
+
+	c := provider("hang,echo")
+	c.Timeout = 50
+	configs := map[string]helper.Config{"a": c}
+	assert.NoError(s.Update(ctx, configs, ".", nil))
+
+	tmpl := template.Must(template.New("a").Funcs(s.Funcs(ctx)).Parse(`{{hang}}`))
+	assert.Error(tmpl.Execute(&bytes.Buffer{}, nil))
+
+	// the killed provider is started again
+	assert.NoError(s.Update(ctx, configs, ".", nil))
+	tmpl = template.Must(template.New("a").Funcs(s.Funcs(ctx)).Parse(`{{echo}}`))
+	assert.NoError(tmpl.Execute(&bytes.Buffer{}, nil))
+}
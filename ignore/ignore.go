@@ -0,0 +1,162 @@
+// Package ignore matches paths against .metaignore files. The files use
+// the gitignore syntax and apply to the directory they are in and every
+// directory below it, with rules in deeper files taking precedence.
+package ignore
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/oligoden/meta/glob"
+)
+
+// Filename is the name of the ignore files.
+const Filename = ".metaignore"
+
+type rule struct {
+	re       *regexp.Regexp
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// Matcher reports whether paths below the root are ignored.
+// The ignore files are read once and cached until Reset is called.
+type Matcher struct {
+	root  string
+	mu    sync.Mutex
+	rules map[string][]rule
+}
+
+func New(root string) *Matcher {
+	return &Matcher{
+		root:  filepath.Clean(root),
+		rules: map[string][]rule{},
+	}
+}
+
+// Reset drops the cached ignore files.
+func (m *Matcher) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rules = map[string][]rule{}
+}
+
+// Ignored reports whether the path is ignored. A path inside an ignored
+// directory is ignored as well. Paths outside the root are never ignored.
+func (m *Matcher) Ignored(path string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(m.root, filepath.Clean(path))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range segments {
+		last := i == len(segments)-1
+		if m.match(segments[:i+1], isDir || !last) {
+			return true
+		}
+	}
+	return false
+}
+
+// match applies the rules of the ignore files in the directories
+// above the path, the last matching rule deciding.
+func (m *Matcher) match(segments []string, isDir bool) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ignored := false
+	for i := 0; i < len(segments); i++ {
+		dir := filepath.Join(append([]string{m.root}, segments[:i]...)...)
+		rel := strings.Join(segments[i:], "/")
+		name := segments[len(segments)-1]
+
+		for _, r := range m.load(dir) {
+			if r.dirOnly && !isDir {
+				continue
+			}
+			target := rel
+			if !r.anchored {
+				target = name
+			}
+			if r.re.MatchString(target) {
+				ignored = !r.negate
+			}
+		}
+	}
+	return ignored
+}
+
+func (m *Matcher) load(dir string) []rule {
+	if rules, ok := m.rules[dir]; ok {
+		return rules
+	}
+
+	rules := []rule{}
+	m.rules[dir] = rules
+
+	f, err := os.Open(filepath.Join(dir, Filename))
+	if err != nil {
+		return rules
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if r, ok := parse(scanner.Text()); ok {
+			rules = append(rules, r)
+		}
+	}
+
+	m.rules[dir] = rules
+	return rules
+}
+
+func parse(line string) (rule, bool) {
+	r := rule{}
+
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return r, false
+	}
+
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	// a pattern with a slash is relative to the ignore file,
+	// otherwise it matches the name at any depth
+	if strings.Contains(line, "/") {
+		r.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return r, false
+	}
+
+	re, err := glob.Compile(line)
+	if err != nil {
+		return r, false
+	}
+	r.re = re
+	return r, true
+}
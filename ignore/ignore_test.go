@@ -0,0 +1,65 @@
+package ignore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/oligoden/meta/ignore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIgnored(t *testing.T) {
+	assert := assert.New(t)
+
+	if err := os.MkdirAll("testing/a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll("testing")
+
+	rules := "# comment\n*.swp\nnode_modules/\n/build\n!keep.swp\na/*.tmp\n"
+	if err := ioutil.WriteFile("testing/.metaignore", []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("testing/a/.metaignore", []byte("!x.swp\nb/*.go\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := ignore.New("testing")
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"testing/x.swp", false, true},
+		{"testing/a/b/y.swp", false, true},
+		{"testing/keep.swp", false, false},
+		{"testing/a/x.swp", false, false},
+		{"testing/node_modules", true, true},
+		{"testing/node_modules", false, false},
+		{"testing/a/node_modules/lib/x.js", false, true},
+		{"testing/build", true, true},
+		{"testing/a/build", true, false},
+		{"testing/build/out.go", false, true},
+		{"testing/a/z.tmp", false, true},
+		{"testing/a/b/z.tmp", false, false},
+		{"testing/a/b/z.go", false, true},
+		{"testing/b/z.go", false, false},
+		{"testing/x.go", false, false},
+		{"testing", true, false},
+		{"other/x.swp", false, false},
+	}
+
+	for _, test := range tests {
+		assert.Equal(test.ignored, m.Ignored(test.path, test.isDir), test.path)
+	}
+
+	if err := ioutil.WriteFile("testing/.metaignore", []byte("*.go\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assert.False(m.Ignored("testing/x.go", false))
+	m.Reset()
+	assert.True(m.Ignored("testing/x.go", false))
+	assert.False(m.Ignored("testing/x.swp", false))
+}
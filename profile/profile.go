@@ -0,0 +1,173 @@
+// Package profile records the time spent per node and phase of a build
+// and writes it as a Chrome trace-event file, which can be opened in
+// chrome://tracing or https://ui.perfetto.dev.
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The phases of a node. Process and Perform are the phases of the build,
+// the other phases are parts of Perform.
+const (
+	Process = "process"
+	Perform = "perform"
+	Parse   = "parse"
+	Execute = "execute"
+	Filter  = "filter"
+	Copy    = "copy"
+	Write   = "write"
+	Exec    = "exec"
+)
+
+// Span is the time spent in a phase of a node.
+type Span struct {
+	Node     string
+	Phase    string
+	Start    time.Time
+	Duration time.Duration
+}
+
+// Profile records spans. A nil profile records nothing, so that nodes
+// can record their phases without checking whether profiling is on.
+type Profile struct {
+	mu    sync.Mutex
+	start time.Time
+	spans []Span
+}
+
+// New returns a profile starting now.
+func New() *Profile {
+	return &Profile{start: time.Now()}
+}
+
+// Add records the phase of the node from the start until now.
+func (p *Profile) Add(node, phase string, start time.Time) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.spans = append(p.spans, Span{
+		Node:     node,
+		Phase:    phase,
+		Start:    start,
+		Duration: time.Since(start),
+	})
+}
+
+// Spans returns the recorded spans.
+func (p *Profile) Spans() []Span {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Span{}, p.spans...)
+}
+
+// Node is the time spent on a node.
+type Node struct {
+	ID string
+	// Duration is the time spent in Process and Perform.
+	Duration time.Duration
+	Phases   map[string]time.Duration
+}
+
+// Nodes returns the time spent per node, sorted from slow to fast.
+func (p *Profile) Nodes() []Node {
+	byID := map[string]*Node{}
+	for _, s := range p.Spans() {
+		n, ok := byID[s.Node]
+		if !ok {
+			n = &Node{ID: s.Node, Phases: map[string]time.Duration{}}
+			byID[s.Node] = n
+		}
+		n.Phases[s.Phase] += s.Duration
+		if s.Phase == Process || s.Phase == Perform {
+			n.Duration += s.Duration
+		}
+	}
+
+	nodes := []Node{}
+	for _, n := range byID {
+		nodes = append(nodes, *n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Duration != nodes[j].Duration {
+			return nodes[i].Duration > nodes[j].Duration
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+	return nodes
+}
+
+// Slowest returns the n slowest nodes.
+func (p *Profile) Slowest(n int) []Node {
+	nodes := p.Nodes()
+	if n < len(nodes) {
+		nodes = nodes[:n]
+	}
+	return nodes
+}
+
+type traceEvent struct {
+	Name string            `json:"name"`
+	Cat  string            `json:"cat"`
+	Ph   string            `json:"ph"`
+	Ts   int64             `json:"ts"`
+	Dur  int64             `json:"dur"`
+	Pid  int               `json:"pid"`
+	Tid  int               `json:"tid"`
+	Args map[string]string `json:"args,omitempty"`
+}
+
+// WriteTrace writes the spans as complete events of the trace-event
+// format, in microseconds from the start of the profile. The phases of
+// Perform are nested in the Perform span of their node.
+func (p *Profile) WriteTrace(w io.Writer) error {
+	spans := p.Spans()
+	// enclosing spans first
+	sort.SliceStable(spans, func(i, j int) bool {
+		if !spans[i].Start.Equal(spans[j].Start) {
+			return spans[i].Start.Before(spans[j].Start)
+		}
+		return spans[i].Duration > spans[j].Duration
+	})
+
+	events := []traceEvent{}
+	for _, s := range spans {
+		name := s.Node
+		if s.Phase != Process && s.Phase != Perform {
+			name = s.Phase
+		}
+		events = append(events, traceEvent{
+			Name: name,
+			Cat:  s.Phase,
+			Ph:   "X",
+			Ts:   s.Start.Sub(p.start).Microseconds(),
+			Dur:  s.Duration.Microseconds(),
+			Pid:  1,
+			Tid:  1,
+			Args: map[string]string{"node": s.Node, "phase": s.Phase},
+		})
+	}
+
+	err := json.NewEncoder(w).Encode(struct {
+		TraceEvents     []traceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}{events, "ms"})
+	if err != nil {
+		return fmt.Errorf("encoding trace, %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package profile_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/oligoden/meta/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodes(t *testing.T) {
+	assert := assert.New(t)
+
+	p := profile.New()
+	start := time.Now()
+	p.Add("file:a", profile.Process, start)
+	time.Sleep(2 * time.Millisecond)
+	p.Add("file:a", profile.Parse, start)
+	p.Add("file:a", profile.Perform, start)
+	p.Add("prj:p", profile.Perform, time.Now())
+
+	nodes := p.Nodes()
+	if assert.Len(nodes, 2) {
+		assert.Equal("file:a", nodes[0].ID)
+		assert.Equal(nodes[0].Phases[profile.Process]+nodes[0].Phases[profile.Perform], nodes[0].Duration)
+		assert.Contains(nodes[0].Phases, profile.Parse)
+		assert.Equal("prj:p", nodes[1].ID)
+	}
+	assert.Len(p.Slowest(1), 1)
+	assert.Len(p.Slowest(5), 2)
+
+	var none *profile.Profile
+	none.Add("file:a", profile.Process, start)
+	assert.Empty(none.Nodes())
+}
+
+func TestWriteTrace(t *testing.T) {
+	assert := assert.New(t)
+
+	p := profile.New()
+	start := time.Now()
+	p.Add("file:a", profile.Parse, start)
+	p.Add("file:a", profile.Perform, start)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(p.WriteTrace(buf))
+
+	trace := struct {
+		TraceEvents []map[string]interface{}
+	}{}
+	assert.NoError(json.Unmarshal(buf.Bytes(), &trace))
+	if assert.Len(trace.TraceEvents, 2) {
+		// the enclosing perform span comes first
+		assert.Equal("file:a", trace.TraceEvents[0]["name"])
+		assert.Equal("perform", trace.TraceEvents[0]["cat"])
+		assert.Equal("X", trace.TraceEvents[0]["ph"])
+		assert.Equal("parse", trace.TraceEvents[1]["name"])
+		assert.Equal(map[string]interface{}{"node": "file:a", "phase": "parse"}, trace.TraceEvents[1]["args"])
+	}
+}
@@ -0,0 +1,104 @@
+package refmap
+
+import (
+	"sort"
+
+	"github.com/oligoden/meta/entity/state"
+)
+
+// causeOp lists the cause chains of the changed nodes.
+type causeOp struct {
+	list chan map[string][]string
+}
+
+func (o causeOp) handle(refs map[string]Actioner, causes map[string][]string) {
+	list := map[string][]string{}
+	for key, ref := range refs {
+		switch ref.State() {
+		case state.Updated, state.Added, state.Remove:
+		default:
+			continue
+		}
+		if chain, found := causes[key]; found {
+			list[key] = append([]string{}, chain...)
+			continue
+		}
+		list[key] = []string{key, reason(ref.State())}
+	}
+	o.list <- list
+}
+
+// reason describes a change detected from the state of a node itself.
+func reason(s uint8) string {
+	if s == state.Remove {
+		return "removed"
+	}
+	return state.Name(s)
+}
+
+// flagCause records the cause of a node set to update or remove.
+func flagCause(key, cause string, causes map[string][]string) {
+	if cause == "" {
+		cause = "flagged"
+	}
+	causes[key] = []string{key, cause}
+}
+
+// propagateCauses records the cause chains of the nodes downstream of
+// the sources, from the node over the links back to the source and the
+// cause of the source. The first chain found for a node is kept.
+func propagateCauses(sources []string, refs map[string]Actioner, links map[[2]string]*link, causes map[string][]string) {
+	next := map[string][]string{}
+	for l := range links {
+		next[l[0]] = append(next[l[0]], l[1])
+	}
+	for _, ends := range next {
+		sort.Strings(ends)
+	}
+
+	// the sources changed themselves
+	sort.Strings(sources)
+	for _, source := range sources {
+		if _, found := causes[source]; !found {
+			if ref, found := refs[source]; found {
+				causes[source] = []string{source, reason(ref.State())}
+			}
+		}
+	}
+
+	for _, source := range sources {
+		queue := []string{source}
+		for len(queue) > 0 {
+			node := queue[0]
+			queue = queue[1:]
+			for _, end := range next[node] {
+				if _, found := causes[end]; found {
+					continue
+				}
+				causes[end] = append([]string{end}, causes[node]...)
+				queue = append(queue, end)
+			}
+		}
+	}
+}
+
+// Causes returns the cause chains of the nodes changed in this build,
+// by node. A chain starts with the node and goes up the graph to the
+// change that caused it, such as
+//
+//	exec:gen <- file:api/model.go <- fs write
+//
+// The chains are cleared by Finish.
+func (r Store) Causes() map[string][]string {
+	op := &causeOp{
+		list: make(chan map[string][]string),
+	}
+	r.Whys <- op
+	return <-op.list
+}
+
+// Cause returns the cause chain of the node, or nil if the node did not
+// change.
+func (r Store) Cause(key string) []string {
+	return r.Causes()[key]
+}
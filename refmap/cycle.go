@@ -0,0 +1,104 @@
+package refmap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	graph "github.com/oligoden/math-graph"
+)
+
+// CycleError reports a cycle in the graph. Path lists the identifiers
+// on the cycle, starting and ending with the same node, and Origins
+// holds the configured mapping that introduced each edge
+// Path[i] -> Path[i+1] (empty for edges of the project structure).
+type CycleError struct {
+	Path    []string
+	Origins []string
+}
+
+func (e *CycleError) Error() string {
+	msg := "cycle detected: " + strings.Join(e.Path, " -> ")
+	for i, origin := range e.Origins {
+		if origin == "" {
+			continue
+		}
+		msg += fmt.Sprintf("\n\t%s -> %s from %s", e.Path[i], e.Path[i+1], origin)
+	}
+	return msg
+}
+
+func evaluate(links map[[2]string]*link, g *graph.Graph) error {
+	path := findCycle(g)
+	if path != nil {
+		e := &CycleError{Path: path}
+		for i := 0; i < len(path)-1; i++ {
+			origin := ""
+			if l, ok := links[[2]string{path[i], path[i+1]}]; ok {
+				origin = l.origin
+			}
+			e.Origins = append(e.Origins, origin)
+		}
+		return e
+	}
+
+	return g.Evaluate()
+}
+
+// findCycle does a depth first search over the graph and returns the
+// first cycle found, or nil if the graph is acyclic. Nodes and children
+// are visited in sorted order to report the same cycle on every run.
+func findCycle(g *graph.Graph) []string {
+	nds, lks := g.Graph()
+	sort.Strings(nds)
+
+	children := map[string][]string{}
+	for _, l := range lks {
+		children[l[0]] = append(children[l[0]], l[1])
+	}
+	for _, c := range children {
+		sort.Strings(c)
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := map[string]int{}
+	stack := []string{}
+
+	var visit func(string) []string
+	visit = func(node string) []string {
+		marks[node] = visiting
+		stack = append(stack, node)
+
+		for _, child := range children[node] {
+			switch marks[child] {
+			case visiting:
+				for i, n := range stack {
+					if n == child {
+						return append(append([]string{}, stack[i:]...), child)
+					}
+				}
+			case unvisited:
+				if cycle := visit(child); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		marks[node] = visited
+		return nil
+	}
+
+	for _, node := range nds {
+		if marks[node] == unvisited {
+			if cycle := visit(node); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package refmap
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// inputOp registers a file read by a node, or lists the registered
+// files when no key is given.
+type inputOp struct {
+	key  string
+	path string
+	list chan map[string][]string
+	rsp  chan error
+}
+
+func (o inputOp) handle(refs map[string]Actioner, inputs map[string]map[string]bool) {
+	if o.key == "" {
+		list := map[string][]string{}
+		for path, keys := range inputs {
+			for key := range keys {
+				// inputs of nodes removed from the refmap are dropped
+				if _, found := refs[key]; !found {
+					delete(keys, key)
+					continue
+				}
+				list[path] = append(list[path], key)
+			}
+			if len(keys) == 0 {
+				delete(inputs, path)
+				continue
+			}
+			sort.Strings(list[path])
+		}
+		o.list <- list
+		return
+	}
+
+	if _, found := refs[o.key]; !found {
+		o.rsp <- fmt.Errorf("ref %s does not exist", o.key)
+		return
+	}
+	if inputs[o.path] == nil {
+		inputs[o.path] = map[string]bool{}
+	}
+	inputs[o.path][o.key] = true
+	o.rsp <- nil
+}
+
+// AddInput registers a file that is read by the node, such as an
+// imported config or a template, so that a change to the file
+// updates the node.
+func (r Store) AddInput(ctx context.Context, key, path string) error {
+	Logger(ctx).Log(ctx, LevelTrace, "adding input", "node", key, "path", path)
+
+	op := &inputOp{
+		key:  key,
+		path: filepath.Clean(path),
+		rsp:  make(chan error),
+	}
+	r.Inps <- op
+	return <-op.rsp
+}
+
+// Inputs returns the registered files with the nodes reading them.
+func (r Store) Inputs() map[string][]string {
+	op := &inputOp{
+		list: make(chan map[string][]string),
+	}
+	r.Inps <- op
+	return <-op.list
+}
@@ -0,0 +1,24 @@
+package refmap
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Log levels for the verbosity levels 2 and 3. Verbosity level 1 logs
+// at slog.LevelDebug.
+const (
+	LevelDetail = slog.LevelDebug - 2
+	LevelTrace  = slog.LevelDebug - 4
+)
+
+// Logger returns the logger in the context, set under the "logger" key,
+// or the default logger.
+func Logger(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(ContextKey("logger")).(*slog.Logger); ok {
+			return l
+		}
+	}
+	return slog.Default()
+}
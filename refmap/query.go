@@ -0,0 +1,101 @@
+package refmap
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/oligoden/meta/entity/state"
+)
+
+// Matcher matches node identifiers.
+type Matcher interface {
+	MatchString(string) bool
+}
+
+// Querier registers the nodes read by nodes.
+type Querier interface {
+	SetQueries(context.Context, string, ...Matcher) error
+}
+
+// queryOp replaces the queries of a node.
+type queryOp struct {
+	key      string
+	matchers []Matcher
+	rsp      chan error
+}
+
+func (o queryOp) handle(refs map[string]Actioner, queries map[string][]Matcher) {
+	if _, found := refs[o.key]; !found {
+		o.rsp <- fmt.Errorf("ref %s does not exist", o.key)
+		return
+	}
+	if len(o.matchers) == 0 {
+		delete(queries, o.key)
+	} else {
+		queries[o.key] = o.matchers
+	}
+	o.rsp <- nil
+}
+
+// SetQueries registers the nodes read by the node, such as the files of
+// a directory read by a template, replacing the nodes registered before.
+// A change to a node that is matched, including a matching node that is
+// added or removed, updates the node.
+func (r Store) SetQueries(ctx context.Context, key string, matchers ...Matcher) error {
+	Logger(ctx).Log(ctx, LevelTrace, "setting queries", "node", key, "queries", len(matchers))
+
+	op := &queryOp{
+		key:      key,
+		matchers: matchers,
+		rsp:      make(chan error),
+	}
+	r.Qrys <- op
+	return <-op.rsp
+}
+
+// readers flags the nodes with queries matching the sources, other than
+// the sources themselves, and records their causes. It returns the
+// readers flagged.
+func readers(sources []string, refs map[string]Actioner, queries map[string][]Matcher, causes map[string][]string) []string {
+	sort.Strings(sources)
+	isSource := map[string]bool{}
+	for _, source := range sources {
+		isSource[source] = true
+	}
+
+	keys := make([]string, 0, len(queries))
+	for key := range queries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	flagged := []string{}
+	for _, key := range keys {
+		ref, found := refs[key]
+		if !found || isSource[key] {
+			continue
+		}
+	sources:
+		for _, source := range sources {
+			for _, m := range queries[key] {
+				if !m.MatchString(source) {
+					continue
+				}
+				if ref.State() != state.Added && ref.State() != state.Remove {
+					ref.FlagState()
+				}
+				if _, found := causes[key]; !found {
+					chain := causes[source]
+					if chain == nil {
+						chain = []string{source, reason(refs[source].State())}
+					}
+					causes[key] = append([]string{key}, chain...)
+				}
+				flagged = append(flagged, key)
+				break sources
+			}
+		}
+	}
+	return flagged
+}
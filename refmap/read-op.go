@@ -1,6 +1,7 @@
 package refmap
 
 import (
+	"sort"
 	"strings"
 
 	graph "github.com/oligoden/math-graph"
@@ -12,10 +13,20 @@ type readOp struct {
 	selection string
 	node      string
 	nodes     chan string
+	edges     chan [2]string
+	runs      chan Run
+	snapshot  chan map[string]uint8
 	Refs      chan Actioner
 }
 
-func (o readOp) topological(refs map[string]Actioner, g *graph.Graph) {
+// Run is a run of a changed node. Upstream is the changed upstream node
+// that triggered the run over an edge with RecurUpstream, or empty.
+type Run struct {
+	Ref      Actioner
+	Upstream string
+}
+
+func (o readOp) topological(refs map[string]Actioner, runs map[string][]string, g *graph.Graph) {
 	// fmt.Printf("\n\n%+v\n\n", g)
 	// fmt.Printf("\n\n%+v\n\n", g.StartNodes())
 
@@ -23,15 +34,35 @@ func (o readOp) topological(refs map[string]Actioner, g *graph.Graph) {
 		if o.filter != "" && !strings.HasPrefix(ref, o.filter) {
 			return nil
 		}
-		if o.selection == "changed" &&
-			(refs[ref].State() == state.Updated ||
-				refs[ref].State() == state.Added) {
+		// nodes set for removal are changed as well, they run to
+		// remove their output, such as the destination of a file
+		if o.selection == "changed" || o.selection == "runs" {
+			switch refs[ref].State() {
+			case state.Updated, state.Added, state.Remove:
+			default:
+				return nil
+			}
+		}
+		if o.selection != "runs" {
 			o.Refs <- refs[ref]
 			return nil
 		}
-		o.Refs <- refs[ref]
+
+		// a node triggered by several upstream nodes over edges
+		// with RecurUpstream runs once per upstream
+		if ups := runs[ref]; len(ups) > 0 && refs[ref].State() != state.Remove {
+			for _, up := range ups {
+				o.runs <- Run{Ref: refs[ref], Upstream: up}
+			}
+			return nil
+		}
+		o.runs <- Run{Ref: refs[ref]}
 		return nil
 	})
+	if o.selection == "runs" {
+		close(o.runs)
+		return
+	}
 	close(o.Refs)
 }
 
@@ -46,6 +77,67 @@ func (o readOp) parents(node string, refs map[string]Actioner, g *graph.Graph) {
 	close(o.nodes)
 }
 
+func (o readOp) links(states map[string]uint8, g *graph.Graph) {
+	_, lks := g.Graph()
+	sort.Slice(lks, func(i, j int) bool {
+		if lks[i][0] != lks[j][0] {
+			return lks[i][0] < lks[j][0]
+		}
+		return lks[i][1] < lks[j][1]
+	})
+
+	for _, l := range lks {
+		removed := false
+		for _, key := range l {
+			if st, found := states[key]; found && st == state.Remove {
+				removed = true
+			}
+		}
+		if !removed {
+			o.edges <- [2]string{l[0], l[1]}
+		}
+	}
+	close(o.edges)
+}
+
+func (o readOp) states(states map[string]uint8) {
+	snapshot := make(map[string]uint8, len(states))
+	for key, st := range states {
+		snapshot[key] = st
+	}
+	o.snapshot <- snapshot
+}
+
+// States returns the states of the nodes by node, as recorded after the
+// last set operation, such as Propagate, Assess or Finish. Unlike the
+// states of the nodes returned by Nodes, they can be read while another
+// goroutine processes and builds the nodes.
+func (r Store) States() map[string]uint8 {
+	states := &readOp{
+		selection: "states",
+		snapshot:  make(chan map[string]uint8),
+	}
+	r.Read <- states
+	return <-states.snapshot
+}
+
+// Links returns the edges of the graph sorted by start and end node,
+// leaving out the edges of nodes set for removal as of the last set
+// operation.
+func (r Store) Links() [][2]string {
+	links := &readOp{
+		selection: "links",
+		edges:     make(chan [2]string),
+	}
+	r.Read <- links
+
+	edges := [][2]string{}
+	for edge := range links.edges {
+		edges = append(edges, edge)
+	}
+	return edges
+}
+
 // Nodes returns a slice of the nodes.
 func (r Store) Nodes(props ...string) []Actioner {
 	selection := ""
@@ -72,7 +164,25 @@ func (r Store) Nodes(props ...string) []Actioner {
 	return refs
 }
 
-// ChangedRefs returns a slice of the nodes that has changed.
+// ChangedRuns returns the runs of the nodes that has changed, in the
+// order to perform them. A node triggered over edges with RecurUpstream
+// has a run for every changed upstream node.
+func (r Store) ChangedRuns() []Run {
+	runs := []Run{}
+	changed := &readOp{
+		selection: "runs",
+		runs:      make(chan Run),
+	}
+	r.Read <- changed
+
+	for run := range changed.runs {
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// ChangedRefs returns a slice of the nodes that has changed, which are
+// the added and updated nodes and the nodes set for removal.
 func (r Store) ChangedRefs() []Actioner {
 	refs := []Actioner{}
 	changed := &readOp{
@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/oligoden/meta/entity/state"
 	"github.com/oligoden/meta/refmap"
 	"github.com/stretchr/testify/assert"
 )
@@ -46,3 +47,101 @@ func TestReadChanged(t *testing.T) {
 	// 	fmt.Println("expected 2 changed refs, got", len(rspNodes))
 	// }
 }
+
+func TestReadChangedAddedRemoved(t *testing.T) {
+	assert := assert.New(t)
+
+	rm := refmap.Start()
+	ctx := context.Background()
+
+	refs := map[string]*testRef{}
+	for _, key := range []string{"a", "b", "c"} {
+		refs[key] = newTestRef(key)
+		refs[key].ProcessState(key)
+		rm.AddRef(ctx, key, refs[key])
+	}
+	rm.MapRef(ctx, "a", "c")
+	rm.MapRef(ctx, "b", "c")
+	assert.NoError(rm.Evaluate())
+	rm.Finish()
+
+	changed := func() []string {
+		names := []string{}
+		for _, ref := range rm.ChangedRefs() {
+			names = append(names, ref.(*testRef).Name)
+		}
+		return names
+	}
+
+	// an added node runs and so do the nodes downstream of it
+	refs["d"] = newTestRef("d")
+	refs["d"].ProcessState("d")
+	rm.AddRef(ctx, "d", refs["d"])
+	rm.MapRef(ctx, "d", "c")
+	assert.NoError(rm.Evaluate())
+	rm.Propagate()
+	assert.ElementsMatch([]string{"d", "c"}, changed())
+	assert.Equal(state.Updated, refs["c"].State())
+	rm.Finish()
+
+	// a removed node runs to remove its output and the nodes downstream
+	// of it run without it
+	for _, key := range []string{"a", "c", "d"} {
+		refs[key].ProcessState(key)
+	}
+	rm.Assess()
+	rm.Propagate()
+	assert.ElementsMatch([]string{"b", "c"}, changed())
+	assert.Equal(state.Remove, refs["b"].State())
+	rm.Finish()
+	assert.Len(rm.Nodes(), 3)
+	assert.Empty(changed())
+}
+
+func TestReadLinks(t *testing.T) {
+	assert := assert.New(t)
+
+	rm := refmap.Start()
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, refmap.ContextKey("verbose"), 0)
+
+	for _, key := range []string{"a", "b", "c"} {
+		ref := newTestRef(key)
+		ref.ProcessState(key)
+		rm.AddRef(ctx, key, ref)
+	}
+	rm.MapRef(ctx, "b", "c")
+	rm.MapRef(ctx, "a", "c")
+	rm.MapRef(ctx, "a", "b")
+	rm.Evaluate()
+
+	assert.Equal([][2]string{{"a", "b"}, {"a", "c"}, {"b", "c"}}, rm.Links())
+
+	rm.SetRemove("b")
+	assert.Equal([][2]string{{"a", "c"}}, rm.Links())
+}
+
+func TestReadStates(t *testing.T) {
+	assert := assert.New(t)
+
+	rm := refmap.Start()
+	ctx := context.Background()
+
+	a := newTestRef("a")
+	a.ProcessState("a")
+	rm.AddRef(ctx, "a", a)
+	assert.Empty(rm.States())
+
+	rm.Evaluate()
+	assert.Equal(map[string]uint8{"a": state.Added}, rm.States())
+
+	// the nodes changed after the last set operation are not read
+	a.ClearState()
+	assert.Equal(map[string]uint8{"a": state.Added}, rm.States())
+
+	rm.SetRemove("a")
+	assert.Equal(map[string]uint8{"a": state.Remove}, rm.States())
+
+	rm.Finish()
+	assert.Empty(rm.States())
+}
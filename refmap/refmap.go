@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"regexp"
 
@@ -13,6 +14,19 @@ import (
 
 type ContextKey string
 
+// Recurrence of a mapped edge sets how many times the end node of the
+// edge runs when it is triggered through the edge in one build cycle.
+const (
+	// RecurDefault leaves the recurrence to the default, RecurBatch.
+	RecurDefault uint = iota
+	// RecurBatch runs the end node once per cycle, no matter how many
+	// of its upstream nodes changed.
+	RecurBatch
+	// RecurUpstream runs the end node once for every changed upstream
+	// node linked to it, with the upstream node given to the run.
+	RecurUpstream
+)
+
 // Actioner performs actions on the data provided.
 type Actioner interface {
 	Perform(Grapher, context.Context) error
@@ -30,23 +44,64 @@ type Grapher interface {
 	Nodes(...string) []Actioner
 }
 
+// Causer reads the cause chains of the changed nodes.
+type Causer interface {
+	Cause(string) []string
+}
+
+// CauseGrapher is a graph that also reads the causes of its changes,
+// as used to perform the changed nodes.
+type CauseGrapher interface {
+	Grapher
+	Causer
+}
+
 type Mutator interface {
 	AddRef(context.Context, string, Actioner)
 	RenameRef(context.Context, string, string)
 	MapRef(context.Context, string, string, ...uint) error
+	Inputter
 	Grapher
 }
 
+// Inputter registers the files read by nodes.
+type Inputter interface {
+	AddInput(context.Context, string, string) error
+}
+
 type Store struct {
 	Adds       chan *addOp
 	Rnms       chan *rnmOp
 	Maps       chan *mapOp
 	Sets       chan *SetOp
+	Inps       chan *inputOp
+	Whys       chan *causeOp
+	Qrys       chan *queryOp
 	Read       chan *readOp
 	OutputChan chan struct{}
 	// Removed chan *RemovedOp
 	refs  map[string]Actioner
-	graph *graph.Graph
+	links map[[2]string]*link
+	// the changed upstream nodes of nodes linked with RecurUpstream,
+	// by node
+	runs map[string][]string
+	// the files read by nodes, by path
+	inputs map[string]map[string]bool
+	// the cause chains of the changed nodes, by node
+	causes map[string][]string
+	// the nodes read by nodes, by node
+	queries map[string][]Matcher
+	// the states of the nodes after the last set operation, so that
+	// they are read without reading the nodes, which are changed by
+	// the goroutine processing them
+	states map[string]uint8
+	graph  *graph.Graph
+}
+
+// link holds the properties of a mapped edge.
+type link struct {
+	origin     string
+	recurrence uint
 }
 
 func Start() *Store {
@@ -55,10 +110,19 @@ func Start() *Store {
 	s.Rnms = make(chan *rnmOp)
 	s.Maps = make(chan *mapOp)
 	s.Sets = make(chan *SetOp)
+	s.Inps = make(chan *inputOp)
+	s.Whys = make(chan *causeOp)
+	s.Qrys = make(chan *queryOp)
 	s.Read = make(chan *readOp)
 	s.OutputChan = make(chan struct{})
 
 	s.refs = make(map[string]Actioner)
+	s.links = make(map[[2]string]*link)
+	s.runs = make(map[string][]string)
+	s.inputs = make(map[string]map[string]bool)
+	s.causes = make(map[string][]string)
+	s.queries = make(map[string][]Matcher)
+	s.states = make(map[string]uint8)
 	s.graph = graph.New()
 
 	go func() {
@@ -67,22 +131,43 @@ func Start() *Store {
 			case a := <-s.Adds:
 				a.handle(s.refs, s.graph)
 			case a := <-s.Rnms:
-				a.handle(s.refs, s.graph)
+				a.handle(s.refs, s.links, s.inputs, s.queries, s.graph)
 			case a := <-s.Maps:
 				// fmt.Println("linking", a.start, a.end)
-				a.rsp <- s.graph.Link(a.start, a.end)
+				a.handle(s.links, s.graph)
 			case a := <-s.Sets:
-				a.handle(s.refs, s.graph)
+				// the states are recorded before replying, while
+				// the caller does not change the nodes
+				err := a.handle(s.refs, s.links, s.runs, s.causes, s.queries, s.graph)
+				clear(s.states)
+				for key, ref := range s.refs {
+					s.states[key] = ref.State()
+				}
+				a.Err <- err
+			case a := <-s.Inps:
+				a.handle(s.refs, s.inputs)
+			case a := <-s.Whys:
+				a.handle(s.refs, s.causes)
+			case a := <-s.Qrys:
+				a.handle(s.refs, s.queries)
 			case nodes := <-s.Read:
 				if nodes.selection == "parents" {
 					nodes.parents(nodes.node, s.refs, s.graph)
 					break
 				}
-				nodes.topological(s.refs, s.graph)
+				if nodes.selection == "links" {
+					nodes.links(s.states, s.graph)
+					break
+				}
+				if nodes.selection == "states" {
+					nodes.states(s.states)
+					break
+				}
+				nodes.topological(s.refs, s.runs, s.graph)
 			case <-s.OutputChan:
 				f, err := os.Create("output.gv")
 				if err != nil {
-					fmt.Println("error outputting graph ->", err)
+					slog.Error("error outputting graph", "err", err)
 					break
 				}
 
@@ -127,7 +212,11 @@ func Start() *Store {
 						}
 					}
 
-					fmt.Fprintf(buf, "\t\"%s\" -> \"%s\";\n", link[0], link[1])
+					fmt.Fprintf(buf, "\t\"%s\" -> \"%s\"", link[0], link[1])
+					if l, fnd := s.links[[2]string{link[0], link[1]}]; fnd && l.recurrence == RecurUpstream {
+						fmt.Fprint(buf, ` [style=dashed, label="per upstream"]`)
+					}
+					fmt.Fprintln(buf, ";")
 				}
 
 				buf.WriteString("}")
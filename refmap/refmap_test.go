@@ -2,6 +2,7 @@ package refmap_test
 
 import (
 	"context"
+	"regexp"
 	"testing"
 
 	"github.com/oligoden/meta/entity/state"
@@ -90,6 +91,75 @@ func TestRemoving(t *testing.T) {
 	assert.Len(rm.Nodes(), 1)
 }
 
+func TestRecurrence(t *testing.T) {
+	assert := assert.New(t)
+	rm := refmap.Start()
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, refmap.ContextKey("verbose"), 0)
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		ref := newTestRef(key)
+		ref.ProcessState(key)
+		rm.AddRef(ctx, key, ref)
+	}
+
+	rm.MapRef(ctx, "a", "c", refmap.RecurUpstream)
+	rm.MapRef(ctx, "b", "c", refmap.RecurUpstream)
+	rm.MapRef(ctx, "a", "d")
+	rm.MapRef(ctx, "b", "d")
+	assert.NoError(rm.Evaluate())
+	rm.Finish()
+	assert.Len(rm.ChangedRefs(), 0)
+
+	assert.NoError(rm.SetUpdate("a"))
+	assert.NoError(rm.SetUpdate("b"))
+	rm.Propagate()
+
+	runs := map[string][]string{}
+	for _, run := range rm.ChangedRuns() {
+		name := run.Ref.(*testRef).Name
+		runs[name] = append(runs[name], run.Upstream)
+	}
+	assert.Equal(map[string][]string{"a": {""}, "b": {""}, "c": {"a", "b"}, "d": {""}}, runs)
+	assert.Len(rm.ChangedRefs(), 4)
+
+	rm.Finish()
+	assert.NoError(rm.SetUpdate("a"))
+	rm.Propagate()
+
+	runs = map[string][]string{}
+	for _, run := range rm.ChangedRuns() {
+		name := run.Ref.(*testRef).Name
+		runs[name] = append(runs[name], run.Upstream)
+	}
+	assert.Equal(map[string][]string{"a": {""}, "c": {"a"}, "d": {""}}, runs)
+}
+
+func TestCycle(t *testing.T) {
+	assert := assert.New(t)
+	rm := refmap.Start()
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, refmap.ContextKey("verbose"), 0)
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		rm.AddRef(ctx, key, newTestRef(key))
+	}
+
+	rm.MapRef(ctx, "d", "a")
+	rm.MapRef(context.WithValue(ctx, refmap.ContextKey("mapping"), "m1"), "a", "b")
+	rm.MapRef(ctx, "b", "c")
+	assert.NoError(rm.Evaluate())
+
+	rm.MapRef(context.WithValue(ctx, refmap.ContextKey("mapping"), "m2"), "c", "a")
+	err := rm.Evaluate()
+	var cycle *refmap.CycleError
+	if assert.ErrorAs(err, &cycle) {
+		assert.Equal([]string{"a", "b", "c", "a"}, cycle.Path)
+		assert.Equal([]string{"m1", "", "m2"}, cycle.Origins)
+		assert.Equal("cycle detected: a -> b -> c -> a\n\ta -> b from m1\n\tc -> a from m2", err.Error())
+	}
+}
+
 type testRef struct {
 	Name string
 	*state.Detect
@@ -113,3 +183,129 @@ func (testRef) Output() string {
 func (testRef) Perform(rm refmap.Grapher, c context.Context) error {
 	return nil
 }
+
+func TestInputs(t *testing.T) {
+	assert := assert.New(t)
+
+	rm := refmap.Start()
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, refmap.ContextKey("verbose"), 0)
+
+	t1 := newTestRef("x")
+	t1.ProcessState("x")
+	rm.AddRef(ctx, "a", t1)
+
+	t2 := newTestRef("y")
+	t2.ProcessState("y")
+	rm.AddRef(ctx, "b", t2)
+
+	assert.NoError(rm.AddInput(ctx, "a", "src/./a.ext"))
+	assert.NoError(rm.AddInput(ctx, "a", "src/shared.ext"))
+	assert.NoError(rm.AddInput(ctx, "b", "src/shared.ext"))
+	assert.Error(rm.AddInput(ctx, "c", "src/c.ext"))
+
+	assert.Equal(map[string][]string{
+		"src/a.ext":      {"a"},
+		"src/shared.ext": {"a", "b"},
+	}, rm.Inputs())
+
+	rm.RenameRef(ctx, "a", "d")
+	rm.AddRef(ctx, "d", t1)
+	rm.Evaluate()
+	rm.Finish()
+
+	// b is removed
+	t1.ProcessState("x")
+	rm.Assess()
+	rm.Finish()
+
+	assert.Equal(map[string][]string{
+		"src/a.ext":      {"d"},
+		"src/shared.ext": {"d"},
+	}, rm.Inputs())
+}
+
+func TestCauses(t *testing.T) {
+	assert := assert.New(t)
+
+	rm := refmap.Start()
+	ctx := context.Background()
+
+	for _, key := range []string{"file:a", "dir:d", "exec:gen", "file:b"} {
+		r := newTestRef(key)
+		r.ProcessState(key)
+		rm.AddRef(ctx, key, r)
+	}
+	rm.MapRef(ctx, "file:a", "dir:d")
+	rm.MapRef(ctx, "dir:d", "exec:gen")
+	rm.Evaluate()
+	rm.Finish()
+	assert.Empty(rm.Causes())
+
+	rm.SetUpdate("file:a", "fs write")
+	rm.Propagate()
+
+	assert.Equal(map[string][]string{
+		"file:a":   {"file:a", "fs write"},
+		"dir:d":    {"dir:d", "file:a", "fs write"},
+		"exec:gen": {"exec:gen", "dir:d", "file:a", "fs write"},
+	}, rm.Causes())
+	assert.Nil(rm.Cause("file:b"))
+
+	rm.Finish()
+	assert.Empty(rm.Causes())
+
+	// added nodes are their own cause
+	r := newTestRef("file:c")
+	r.ProcessState("file:c")
+	rm.AddRef(ctx, "file:c", r)
+	rm.MapRef(ctx, "file:c", "exec:gen")
+	rm.Evaluate()
+	rm.Propagate()
+	assert.Equal([]string{"file:c", "added"}, rm.Cause("file:c"))
+	assert.Equal([]string{"exec:gen", "file:c", "added"}, rm.Cause("exec:gen"))
+}
+
+func TestQueries(t *testing.T) {
+	assert := assert.New(t)
+
+	rm := refmap.Start()
+	ctx := context.Background()
+
+	for _, key := range []string{"file:x/a", "file:y/b", "file:index", "exec:gen"} {
+		r := newTestRef(key)
+		r.ProcessState(key)
+		rm.AddRef(ctx, key, r)
+	}
+	rm.MapRef(ctx, "file:index", "exec:gen")
+	assert.NoError(rm.SetQueries(ctx, "file:index", regexp.MustCompile(`^file:x/`)))
+	assert.Error(rm.SetQueries(ctx, "file:none", regexp.MustCompile(`.`)))
+	rm.Evaluate()
+	rm.Finish()
+
+	rm.SetUpdate("file:y/b", "fs write")
+	rm.Propagate()
+	assert.Nil(rm.Cause("file:index"))
+	rm.Finish()
+
+	rm.SetUpdate("file:x/a", "fs write")
+	rm.Propagate()
+	assert.Equal([]string{"file:index", "file:x/a", "fs write"}, rm.Cause("file:index"))
+	assert.Equal([]string{"exec:gen", "file:index", "file:x/a", "fs write"}, rm.Cause("exec:gen"))
+	rm.Finish()
+
+	// added nodes matching a query update the reader
+	r := newTestRef("file:x/c")
+	r.ProcessState("file:x/c")
+	rm.AddRef(ctx, "file:x/c", r)
+	rm.Evaluate()
+	rm.Propagate()
+	assert.Equal([]string{"file:index", "file:x/c", "added"}, rm.Cause("file:index"))
+	rm.Finish()
+
+	// queries are replaced
+	assert.NoError(rm.SetQueries(ctx, "file:index"))
+	rm.SetUpdate("file:x/a", "fs write")
+	rm.Propagate()
+	assert.Nil(rm.Cause("file:index"))
+}
@@ -2,6 +2,9 @@ package refmap
 
 import (
 	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
 
 	graph "github.com/oligoden/math-graph"
 	"github.com/oligoden/meta/entity/state"
@@ -10,95 +13,146 @@ import (
 type SetOp struct {
 	Key string
 	Val string
-	Err chan error
+	// Cause describes why a node is set to update or remove.
+	Cause string
+	Err   chan error
 }
 
-func (o SetOp) handle(refs map[string]Actioner, g *graph.Graph) {
+func (o SetOp) handle(refs map[string]Actioner, links map[[2]string]*link, runs map[string][]string, causes map[string][]string, queries map[string][]Matcher, g *graph.Graph) error {
 	// if o.Key == "location" {
 	// 	*location = o.Val
-	// 	o.Err <- nil
-	// 	return
+	// 	return nil
 	// }
 	if o.Key == "assess" {
-		assess(refs)
-		o.Err <- nil
-		return
+		removed := assess(refs)
+		propagateReaders(removed, refs, links, runs, causes, queries, g)
+		return nil
 	}
 	switch o.Key {
 	case "propagate":
 		if o.Val == "" {
-			propagate(refs, g)
+			propagate(refs, links, runs, causes, queries, g)
 		} else {
-			propagateFrom(o.Val, refs, g)
+			propagateFrom(o.Val, refs, links, runs, causes, queries, g)
 		}
-		o.Err <- nil
+		return nil
 	case "evaluate":
-		g.Evaluate()
-		o.Err <- nil
+		return evaluate(links, g)
 	case "finish":
-		finish(refs, g)
-		o.Err <- nil
-	default:
-		if o.Val == "update" {
-		} else {
-			o.Err <- fmt.Errorf("unknown value")
-			return
-		}
+		finish(refs, links, runs, causes, queries, g)
+		return nil
+	}
+
+	if o.Val != "update" && o.Val != "remove" {
+		return fmt.Errorf("unknown value")
+	}
 
-		if ref, found := refs[o.Key]; found {
+	if ref, found := refs[o.Key]; found {
+		if o.Val == "remove" {
+			ref.RemoveState()
+		} else {
 			ref.FlagState()
-			o.Err <- nil
-			return
 		}
-		o.Err <- fmt.Errorf("key not found")
+		flagCause(o.Key, o.Cause, causes)
+		return nil
 	}
-
+	return fmt.Errorf("key not found")
 }
 
-func assess(refs map[string]Actioner) {
-	for _, ref := range refs {
+// assess sets the nodes that were not processed for removal and returns
+// them.
+func assess(refs map[string]Actioner) []string {
+	removed := []string{}
+	for key, ref := range refs {
 		if ref.State() == state.Stable {
 			ref.RemoveState()
+			removed = append(removed, key)
 		}
 	}
+	return removed
 }
 
-func propagate(refs map[string]Actioner, g *graph.Graph) {
+// propagate flags every node downstream of an updated, added or
+// removed node, and the nodes reading it with their downstream nodes.
+// Added and removed nodes start the propagation like updated nodes, as
+// only changed nodes run and a node downstream of them, such as an exec
+// mapped to the files of a directory, changes with its upstream nodes.
+func propagate(refs map[string]Actioner, links map[[2]string]*link, runs map[string][]string, causes map[string][]string, queries map[string][]Matcher, g *graph.Graph) {
+	sources := []string{}
+	for key, ref := range refs {
+		if ref.State() == state.Updated || ref.State() == state.Added || ref.State() == state.Remove {
+			sources = append(sources, key)
+		}
+	}
+	flag(sources, refs, links, runs, g)
+	propagateCauses(sources, refs, links, causes)
+	propagateReaders(sources, refs, links, runs, causes, queries, g)
+}
+
+// propagateFrom flags every node downstream of the given node.
+func propagateFrom(node string, refs map[string]Actioner, links map[[2]string]*link, runs map[string][]string, causes map[string][]string, queries map[string][]Matcher, g *graph.Graph) {
+	flag([]string{node}, refs, links, runs, g)
+	propagateCauses([]string{node}, refs, links, causes)
+	propagateReaders([]string{node}, refs, links, runs, causes, queries, g)
+}
 
-	for node := range g.StartNodes() {
-		update := false
+// propagateReaders flags the nodes reading the sources and the nodes
+// downstream of them. Only the sources are read, as the nodes downstream
+// of the sources change their output but not the nodes themselves.
+func propagateReaders(sources []string, refs map[string]Actioner, links map[[2]string]*link, runs map[string][]string, causes map[string][]string, queries map[string][]Matcher, g *graph.Graph) {
+	rs := readers(sources, refs, queries, causes)
+	if len(rs) == 0 {
+		return
+	}
+	flag(rs, refs, links, runs, g)
+	propagateCauses(rs, refs, links, causes)
+}
+
+func flag(sources []string, refs map[string]Actioner, links map[[2]string]*link, runs map[string][]string, g *graph.Graph) {
+	flagged := map[string]bool{}
+	for _, source := range sources {
+		flagged[source] = true
 		g.SetRun(func(node string) error {
-			if refs[node].State() == state.Updated {
-				update = true
+			if node == source {
+				return nil
 			}
-			if update {
+			flagged[node] = true
+			if refs[node].State() != state.Added && refs[node].State() != state.Remove {
 				refs[node].FlagState()
 			}
 			return nil
-		}, node)
+		}, source)
 	}
-}
 
-func propagateFrom(node string, refs map[string]Actioner, g *graph.Graph) {
-	update := false
-
-	g.SetRun(func(node string) error {
-		if refs[node].State() == state.Updated {
-			update = true
-		}
-		if update {
-			refs[node].FlagState()
+	// collect the flagged upstream nodes of every flagged node
+	// linked to it over an edge with RecurUpstream
+	for l, v := range links {
+		if v.recurrence == RecurUpstream && flagged[l[0]] && flagged[l[1]] && !slices.Contains(runs[l[1]], l[0]) {
+			runs[l[1]] = append(runs[l[1]], l[0])
+			sort.Strings(runs[l[1]])
 		}
-		return nil
-	}, node)
+	}
 }
 
-func finish(refs map[string]Actioner, g *graph.Graph) {
+func finish(refs map[string]Actioner, links map[[2]string]*link, runs map[string][]string, causes map[string][]string, queries map[string][]Matcher, g *graph.Graph) {
+	for key := range runs {
+		delete(runs, key)
+	}
+	for key := range causes {
+		delete(causes, key)
+	}
+
 	for key, ref := range refs {
 		if ref.State() == state.Remove {
-			fmt.Println("removing", key, "from refmap")
+			slog.Debug("removing node", "node", key)
 			delete(refs, key)
+			delete(queries, key)
 			g.Remove(key)
+			for l := range links {
+				if l[0] == key || l[1] == key {
+					delete(links, l)
+				}
+			}
 			continue
 		}
 
@@ -106,12 +160,33 @@ func finish(refs map[string]Actioner, g *graph.Graph) {
 	}
 }
 
-func (r Store) SetUpdate(key string) error {
+// SetUpdate sets the node to update. The optional cause describes the
+// change, such as "fs write", and starts the cause chains of the nodes
+// flagged by Propagate.
+func (r Store) SetUpdate(key string, cause ...string) error {
 	setter := &SetOp{
 		Key: key,
 		Val: "update",
 		Err: make(chan error),
 	}
+	if len(cause) > 0 {
+		setter.Cause = cause[0]
+	}
+	r.Sets <- setter
+	return <-setter.Err
+}
+
+// SetRemove sets the node for removal. The node is performed
+// in the next build and then removed from the refmap.
+func (r Store) SetRemove(key string, cause ...string) error {
+	setter := &SetOp{
+		Key: key,
+		Val: "remove",
+		Err: make(chan error),
+	}
+	if len(cause) > 0 {
+		setter.Cause = cause[0]
+	}
 	r.Sets <- setter
 	return <-setter.Err
 }
@@ -16,14 +16,11 @@ type addOp struct {
 
 func (o addOp) handle(refs map[string]Actioner, g *graph.Graph) {
 	if _, found := refs[o.key]; !found {
-		verboseValue := o.ctx.Value(ContextKey("verbose")).(int)
-		if verboseValue >= 3 {
-			fmt.Println("adding", o.key)
-		}
+		Logger(o.ctx).Log(o.ctx, LevelTrace, "adding node", "node", o.key)
 		refs[o.key] = o.val
 		g.Add(o.key)
 	} else {
-		fmt.Println("already got", o.key)
+		Logger(o.ctx).Debug("replacing node", "node", o.key)
 		refs[o.key] = o.val
 	}
 
@@ -47,7 +44,7 @@ type rnmOp struct {
 	rsp chan error
 }
 
-func (o rnmOp) handle(refs map[string]Actioner, g *graph.Graph) {
+func (o rnmOp) handle(refs map[string]Actioner, links map[[2]string]*link, inputs map[string]map[string]bool, queries map[string][]Matcher, g *graph.Graph) {
 	if _, found := refs[o.key]; !found {
 		o.rsp <- fmt.Errorf("ref %s does not exist", o.key)
 		return
@@ -56,14 +53,36 @@ func (o rnmOp) handle(refs map[string]Actioner, g *graph.Graph) {
 	delete(refs, o.key)
 	g.Rename(o.key, o.val)
 
+	for l, v := range links {
+		if l[0] == o.key || l[1] == o.key {
+			delete(links, l)
+			if l[0] == o.key {
+				l[0] = o.val
+			}
+			if l[1] == o.key {
+				l[1] = o.val
+			}
+			links[l] = v
+		}
+	}
+
+	for _, keys := range inputs {
+		if keys[o.key] {
+			delete(keys, o.key)
+			keys[o.val] = true
+		}
+	}
+
+	if matchers, found := queries[o.key]; found {
+		delete(queries, o.key)
+		queries[o.val] = matchers
+	}
+
 	o.rsp <- nil
 }
 
 func (r Store) RenameRef(ctx context.Context, key string, val string) {
-	verboseValue := ctx.Value(ContextKey("verbose")).(int)
-	if verboseValue >= 3 {
-		fmt.Println("renaming", key, "to", val)
-	}
+	Logger(ctx).Log(ctx, LevelTrace, "renaming node", "node", key, "to", val)
 
 	rn := &rnmOp{
 		key: key,
@@ -75,28 +94,45 @@ func (r Store) RenameRef(ctx context.Context, key string, val string) {
 }
 
 type mapOp struct {
-	start string
-	end   string
-	set   uint
-	rsp   chan error
+	start  string
+	end    string
+	set    uint
+	origin string
+	rsp    chan error
 }
 
-func (r Store) MapRef(ctx context.Context, key0, key1 string, setOption ...uint) error {
-	verboseValue := ctx.Value(ContextKey("verbose")).(int)
-	if verboseValue >= 3 {
-		fmt.Println("mapping", key0, key1)
+func (o mapOp) handle(links map[[2]string]*link, g *graph.Graph) {
+	err := g.Link(o.start, o.end)
+	if err != nil {
+		o.rsp <- err
+		return
 	}
 
-	set := uint(1)
-	if len(setOption) > 0 {
+	links[[2]string{o.start, o.end}] = &link{
+		origin:     o.origin,
+		recurrence: o.set,
+	}
+	o.rsp <- nil
+}
+
+func (r Store) MapRef(ctx context.Context, key0, key1 string, setOption ...uint) error {
+	Logger(ctx).Log(ctx, LevelTrace, "mapping nodes", "node", key0, "to", key1)
+
+	set := RecurBatch
+	if len(setOption) > 0 && setOption[0] != RecurDefault {
 		set = setOption[0]
 	}
 
+	// the origin describes where the mapping was configured
+	// and is used to report cycles
+	origin, _ := ctx.Value(ContextKey("mapping")).(string)
+
 	m := &mapOp{
-		start: key0,
-		end:   key1,
-		set:   set,
-		rsp:   make(chan error),
+		start:  key0,
+		end:    key1,
+		set:    set,
+		origin: origin,
+		rsp:    make(chan error),
 	}
 	r.Maps <- m
 	return <-m.rsp
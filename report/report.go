@@ -0,0 +1,207 @@
+// Package report writes machine-readable reports of builds, as JSON or
+// as JUnit XML for CI dashboards.
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The results of a node in a build.
+const (
+	Built   = "built"
+	Skipped = "skipped"
+	Failed  = "failed"
+	Removed = "removed"
+)
+
+// Record is the result of a node in a build.
+type Record struct {
+	ID     string `json:"id"`
+	Kind   string `json:"kind"`
+	Result string `json:"result"`
+	// Before and After are the states of the node before and after
+	// the build.
+	Before   string        `json:"state_before"`
+	After    string        `json:"state_after"`
+	Duration time.Duration `json:"duration_ns"`
+	Error    string        `json:"error,omitempty"`
+	// Output is the path written by a file and ExitCode the exit code
+	// of an exec.
+	Output   string `json:"output,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	// Phases is the time spent per phase of the node, such as parse
+	// and write.
+	Phases map[string]time.Duration `json:"phases_ns,omitempty"`
+}
+
+// Report is the report of a build.
+type Report struct {
+	Project  string        `json:"project"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration_ns"`
+	Nodes    []Record      `json:"nodes"`
+}
+
+// New returns an empty report of the project started now.
+func New(project string) *Report {
+	return &Report{
+		Project: project,
+		Started: time.Now(),
+		Nodes:   []Record{},
+	}
+}
+
+// Add adds the record with the kind taken from the identifier.
+func (r *Report) Add(rec Record) {
+	if rec.Kind == "" {
+		rec.Kind = Kind(rec.ID)
+	}
+	r.Nodes = append(r.Nodes, rec)
+}
+
+// Kind returns the kind of the node, such as file or exec.
+func Kind(id string) string {
+	kind, _, _ := strings.Cut(id, ":")
+	return kind
+}
+
+// Count returns the number of nodes with the result.
+func (r *Report) Count(result string) int {
+	n := 0
+	for _, rec := range r.Nodes {
+		if rec.Result == result {
+			n++
+		}
+	}
+	return n
+}
+
+// Write writes the report to the file, as JUnit XML if the file has
+// the .xml extension and as JSON otherwise.
+func (r *Report) Write(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating report, %w", err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".xml") {
+		err = r.WriteJUnit(f)
+	} else {
+		err = r.WriteJSON(f)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteJSON writes the report as JSON with the nodes sorted.
+func (r *Report) WriteJSON(w io.Writer) error {
+	r.sort()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(r)
+	if err != nil {
+		return fmt.Errorf("encoding report, %w", err)
+	}
+	return nil
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as JUnit XML with a test case for every
+// exec and file. Skipped nodes are skipped test cases and failed nodes
+// failures.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	r.sort()
+
+	suite := junitSuite{
+		Name:      r.Project,
+		Time:      seconds(r.Duration),
+		Timestamp: r.Started.Format("2006-01-02T15:04:05"),
+		Cases:     []junitCase{},
+	}
+	for _, rec := range r.Nodes {
+		if rec.Kind != "exec" && rec.Kind != "file" {
+			continue
+		}
+
+		c := junitCase{
+			Name:      rec.ID,
+			Classname: r.Project + "." + rec.Kind,
+			Time:      seconds(rec.Duration),
+		}
+		switch rec.Result {
+		case Failed:
+			c.Failure = &junitFailure{Message: rec.Error, Text: rec.Error}
+			if rec.ExitCode != nil {
+				c.Failure.Text += fmt.Sprintf("\nexit code %d", *rec.ExitCode)
+			}
+			suite.Failures++
+		case Skipped:
+			c.Skipped = &struct{}{}
+			suite.Skipped++
+		}
+		suite.Cases = append(suite.Cases, c)
+		suite.Tests++
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return fmt.Errorf("writing report, %w", err)
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(junitSuites{Suites: []junitSuite{suite}})
+	if err != nil {
+		return fmt.Errorf("encoding report, %w", err)
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func (r *Report) sort() {
+	sort.SliceStable(r.Nodes, func(i, j int) bool {
+		return r.Nodes[i].ID < r.Nodes[j].ID
+	})
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,111 @@
+package report_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oligoden/meta/report"
+	"github.com/stretchr/testify/assert"
+)
+
+func testReport() *report.Report {
+	exitCode := 2
+	r := report.New("abc")
+	r.Duration = 1500 * time.Millisecond
+	r.Add(report.Record{
+		ID:       "file:b.ext",
+		Result:   report.Built,
+		Before:   "added",
+		After:    "stable",
+		Duration: 20 * time.Millisecond,
+		Output:   "out/b.ext",
+	})
+	r.Add(report.Record{
+		ID:       "exec:gen",
+		Result:   report.Failed,
+		Before:   "updated",
+		After:    "stable",
+		Duration: time.Second,
+		Error:    "exit status 2",
+		ExitCode: &exitCode,
+	})
+	r.Add(report.Record{
+		ID:     "file:a.ext",
+		Result: report.Skipped,
+		Before: "stable",
+		After:  "stable",
+	})
+	r.Add(report.Record{
+		ID:     "dir:a",
+		Result: report.Skipped,
+	})
+	return r
+}
+
+func TestWriteJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(testReport().WriteJSON(buf))
+
+	got := struct {
+		Project  string
+		Duration int64 `json:"duration_ns"`
+		Nodes    []map[string]interface{}
+	}{}
+	assert.NoError(json.Unmarshal(buf.Bytes(), &got))
+
+	assert.Equal("abc", got.Project)
+	assert.Equal(int64(1500*time.Millisecond), got.Duration)
+	if assert.Len(got.Nodes, 4) {
+		assert.Equal("dir:a", got.Nodes[0]["id"])
+		assert.Equal("exec:gen", got.Nodes[1]["id"])
+		assert.Equal("exec", got.Nodes[1]["kind"])
+		assert.Equal("failed", got.Nodes[1]["result"])
+		assert.Equal("updated", got.Nodes[1]["state_before"])
+		assert.Equal("exit status 2", got.Nodes[1]["error"])
+		assert.Equal(float64(2), got.Nodes[1]["exit_code"])
+		assert.Equal("out/b.ext", got.Nodes[3]["output"])
+		assert.NotContains(got.Nodes[3], "exit_code")
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(testReport().WriteJUnit(buf))
+
+	xml := buf.String()
+	assert.Contains(xml, `<testsuite name="abc" tests="3" failures="1" skipped="1" time="1.500"`)
+	assert.Contains(xml, `<testcase name="exec:gen" classname="abc.exec" time="1.000">`)
+	assert.Contains(xml, `<failure message="exit status 2">exit status 2&#xA;exit code 2</failure>`)
+	assert.Contains(xml, `<testcase name="file:a.ext" classname="abc.file" time="0.000">`+"\n"+`      <skipped></skipped>`)
+	assert.Contains(xml, `<testcase name="file:b.ext" classname="abc.file" time="0.020"></testcase>`)
+	assert.NotContains(xml, "dir:a")
+}
+
+func TestWrite(t *testing.T) {
+	assert := assert.New(t)
+
+	if err := os.MkdirAll("testing", 0755); err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll("testing")
+
+	assert.NoError(testReport().Write(filepath.Join("testing", "out.json")))
+	content, err := os.ReadFile(filepath.Join("testing", "out.json"))
+	if assert.NoError(err) {
+		assert.Contains(string(content), `"project": "abc"`)
+	}
+
+	assert.NoError(testReport().Write(filepath.Join("testing", "out.xml")))
+	content, err = os.ReadFile(filepath.Join("testing", "out.xml"))
+	if assert.NoError(err) {
+		assert.Contains(string(content), `<testsuites>`)
+	}
+}
@@ -0,0 +1,171 @@
+// Package serve serves the destination directory of a project over HTTP
+// and notifies connected browsers to reload after a rebuild. HTML pages
+// are served with a client script that listens for the notifications.
+package serve
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// EventsPath is the path of the server-sent events stream.
+	EventsPath = "/__meta/events"
+	// ScriptPath is the path of the client script, for pages that
+	// include it themselves.
+	ScriptPath = "/__meta/reload.js"
+)
+
+const script = `(function () {
+	var source = new EventSource("` + EventsPath + `");
+	source.addEventListener("reload", function () {
+		location.reload();
+	});
+})();
+`
+
+var tag = []byte(`<script src="` + ScriptPath + `"></script>`)
+
+type Server struct {
+	Dir string
+
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+	srv     *http.Server
+}
+
+func New(dir string) *Server {
+	return &Server{
+		Dir:     dir,
+		clients: map[chan struct{}]bool{},
+	}
+}
+
+// Start listens on the address and serves in the background.
+func (s *Server) Start(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listening on %s, %w", addr, err)
+	}
+
+	s.srv = &http.Server{Handler: s.Handler()}
+	go s.srv.Serve(l)
+	return nil
+}
+
+// Close stops the server and disconnects the browsers.
+func (s *Server) Close() error {
+	if s == nil || s.srv == nil {
+		return nil
+	}
+	return s.srv.Close()
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(EventsPath, s.events)
+	mux.HandleFunc(ScriptPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Header().Set("Cache-Control", "no-cache")
+		fmt.Fprint(w, script)
+	})
+	mux.HandleFunc("/", s.files)
+	return mux
+}
+
+// Reload notifies the connected browsers to reload.
+func (s *Server) Reload() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.clients {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *Server) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	c := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.clients[c] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-c:
+			fmt.Fprint(w, "event: reload\ndata: reload\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// files serves the files of the directory, injecting the client script
+// into HTML pages.
+func (s *Server) files(w http.ResponseWriter, r *http.Request) {
+	name := filepath.Join(s.Dir, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+
+	info, err := os.Stat(name)
+	if err == nil && info.IsDir() && strings.HasSuffix(r.URL.Path, "/") {
+		name = filepath.Join(name, "index.html")
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == ".html" || ext == ".htm" {
+		content, err := os.ReadFile(name)
+		if err == nil {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write(Inject(content))
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	http.FileServer(http.Dir(s.Dir)).ServeHTTP(w, r)
+}
+
+// Inject adds the client script tag before the closing body tag of the
+// page, or at the end if there is none.
+func Inject(page []byte) []byte {
+	i := bytes.LastIndex(bytes.ToLower(page), []byte("</body>"))
+	if i < 0 {
+		return append(append([]byte{}, page...), tag...)
+	}
+
+	out := make([]byte, 0, len(page)+len(tag))
+	out = append(out, page[:i]...)
+	out = append(out, tag...)
+	return append(out, page[i:]...)
+}
@@ -0,0 +1,83 @@
+package serve_test
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oligoden/meta/serve"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInject(t *testing.T) {
+	assert := assert.New(t)
+
+	tag := `<script src="` + serve.ScriptPath + `"></script>`
+	assert.Equal("<html><BODY>a"+tag+"</BODY></html>", string(serve.Inject([]byte("<html><BODY>a</BODY></html>"))))
+	assert.Equal("<p>a</p>"+tag, string(serve.Inject([]byte("<p>a</p>"))))
+}
+
+func TestServer(t *testing.T) {
+	assert := assert.New(t)
+
+	if err := os.MkdirAll("testing/sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll("testing")
+
+	for name, content := range map[string]string{
+		"testing/sub/index.html": "<body>page</body>",
+		"testing/style.css":      "body {}",
+	} {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := serve.New("testing")
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	body := func(path string) string {
+		rsp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rsp.Body.Close()
+		b, _ := ioutil.ReadAll(rsp.Body)
+		return string(b)
+	}
+	assert.Contains(body("/sub/"), `page<script src="/__meta/reload.js"></script></body>`)
+	assert.Equal("body {}", body("/style.css"))
+	assert.Contains(body(serve.ScriptPath), serve.EventsPath)
+
+	rsp, err := http.Get(ts.URL + serve.EventsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	assert.Equal("text/event-stream", rsp.Header.Get("Content-Type"))
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(rsp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	assert.Equal(": connected", <-lines)
+	<-lines
+
+	s.Reload()
+	select {
+	case line := <-lines:
+		assert.True(strings.HasPrefix(line, "event: reload"))
+	case <-time.After(2 * time.Second):
+		t.Fatal("no reload event")
+	}
+}
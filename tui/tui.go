@@ -0,0 +1,245 @@
+// Package tui is a terminal dashboard for meta up. It shows the node
+// tree with the live node states, the output of the running exec, the
+// duration and error of the last build, and reads key bindings to force
+// nodes, rebuild, pause and switch to the graph view.
+package tui
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Action is a key binding pressed by the user. ID is the selected node
+// for Force.
+type Action struct {
+	Kind string
+	ID   string
+}
+
+const (
+	Force   = "force"
+	Rebuild = "rebuild"
+	Pause   = "pause"
+	Quit    = "quit"
+)
+
+// maxLines is the number of output and log lines kept.
+const maxLines = 500
+
+// Dashboard draws the view on the terminal until closed.
+type Dashboard struct {
+	Actions chan Action
+
+	in      *os.File
+	out     *os.File
+	restore *term.State
+
+	mu    sync.Mutex
+	view  View
+	dirty bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New switches the terminal to the alternate screen in raw mode and
+// starts drawing.
+func New(in, out *os.File, title string) (*Dashboard, error) {
+	if !term.IsTerminal(int(in.Fd())) || !term.IsTerminal(int(out.Fd())) {
+		return nil, errors.New("not a terminal")
+	}
+
+	restore, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	out.WriteString("\x1b[?1049h\x1b[?25l")
+
+	d := &Dashboard{
+		Actions: make(chan Action, 10),
+		in:      in,
+		out:     out,
+		restore: restore,
+		view:    View{Title: title},
+		dirty:   true,
+		done:    make(chan struct{}),
+	}
+
+	d.wg.Add(1)
+	go d.draw()
+	go d.read()
+	return d, nil
+}
+
+// Close restores the terminal.
+func (d *Dashboard) Close() {
+	close(d.done)
+	d.wg.Wait()
+	d.out.WriteString("\x1b[?25h\x1b[?1049l")
+	term.Restore(int(d.in.Fd()), d.restore)
+}
+
+// Update changes the view and redraws it.
+func (d *Dashboard) Update(f func(v *View)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	f(&d.view)
+	d.dirty = true
+}
+
+// Output returns a writer for the output pane.
+func (d *Dashboard) Output() io.Writer {
+	return &lineWriter{d: d, lines: func(v *View) *[]string { return &v.Output }}
+}
+
+// Log returns a writer for the log pane.
+func (d *Dashboard) Log() io.Writer {
+	return &lineWriter{d: d, lines: func(v *View) *[]string { return &v.Log }}
+}
+
+func (d *Dashboard) draw() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		}
+
+		d.mu.Lock()
+		if !d.dirty {
+			d.mu.Unlock()
+			continue
+		}
+		d.dirty = false
+		width, height, err := term.GetSize(int(d.out.Fd()))
+		if err != nil {
+			width, height = 80, 24
+		}
+		lines := Render(d.view, width, height)
+		d.mu.Unlock()
+
+		buf := &bytes.Buffer{}
+		buf.WriteString("\x1b[H")
+		for i, l := range lines {
+			if i > 0 {
+				buf.WriteString("\r\n")
+			}
+			buf.WriteString(l)
+			buf.WriteString("\x1b[K")
+		}
+		buf.WriteString("\x1b[J")
+		d.out.Write(buf.Bytes())
+	}
+}
+
+func (d *Dashboard) read() {
+	buf := make([]byte, 16)
+	for {
+		n, err := d.in.Read(buf)
+		if err != nil {
+			return
+		}
+
+		select {
+		case <-d.done:
+			return
+		default:
+		}
+
+		key := string(buf[:n])
+		switch key {
+		case "q", "\x03":
+			d.send(Action{Kind: Quit})
+		case "j", "\x1b[B":
+			d.move(1)
+		case "k", "\x1b[A":
+			d.move(-1)
+		case "g":
+			d.Update(func(v *View) {
+				v.Graph = !v.Graph
+			})
+		case "f":
+			d.send(Action{Kind: Force, ID: d.selected()})
+		case "r":
+			d.send(Action{Kind: Rebuild})
+		case "p":
+			d.send(Action{Kind: Pause})
+		}
+	}
+}
+
+func (d *Dashboard) send(a Action) {
+	select {
+	case d.Actions <- a:
+	default:
+	}
+}
+
+func (d *Dashboard) move(n int) {
+	d.Update(func(v *View) {
+		v.Selected += n
+		if v.Selected >= len(v.Nodes) {
+			v.Selected = len(v.Nodes) - 1
+		}
+		if v.Selected < 0 {
+			v.Selected = 0
+		}
+	})
+}
+
+func (d *Dashboard) selected() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ids, _ := Tree(d.view.Nodes, d.view.Links)
+	if d.view.Selected < len(ids) {
+		return ids[d.view.Selected]
+	}
+	return ""
+}
+
+// lineWriter adds complete lines to a pane.
+type lineWriter struct {
+	d     *Dashboard
+	lines func(v *View) *[]string
+
+	mu   sync.Mutex
+	part []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.part = append(w.part, p...)
+	i := bytes.LastIndexByte(w.part, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	text := string(w.part[:i])
+	w.part = append([]byte{}, w.part[i+1:]...)
+
+	w.d.Update(func(v *View) {
+		lines := w.lines(v)
+		for _, l := range strings.Split(text, "\n") {
+			*lines = append(*lines, strings.TrimRight(l, "\r"))
+		}
+		if len(*lines) > maxLines {
+			*lines = append([]string{}, (*lines)[len(*lines)-maxLines:]...)
+		}
+	})
+	return len(p), nil
+}
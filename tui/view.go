@@ -0,0 +1,288 @@
+package tui
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Node is a node of the graph with its state.
+type Node struct {
+	ID    string
+	State string
+}
+
+// View is the content of the dashboard.
+type View struct {
+	Title    string
+	Building bool
+	Paused   bool
+
+	Nodes []Node
+	Links [][2]string
+	// Selected is the index of the selected node in the tree.
+	Selected int
+	// Graph shows the edges of the graph instead of the node tree.
+	Graph bool
+
+	// Running is the node being performed and Output the latest
+	// lines printed by execs.
+	Running string
+	Output  []string
+	Log     []string
+
+	Duration time.Duration
+	Error    string
+}
+
+const (
+	reset  = "\x1b[0m"
+	bold   = "\x1b[1m"
+	dim    = "\x1b[2m"
+	red    = "\x1b[31m"
+	green  = "\x1b[32m"
+	yellow = "\x1b[33m"
+	invert = "\x1b[7m"
+)
+
+var stateColors = map[string]string{
+	"checked": dim,
+	"updated": yellow,
+	"added":   green,
+	"remove":  red,
+}
+
+// Keys lists the key bindings shown in the footer.
+const Keys = "↑/↓ select  f force  r rebuild  g graph  p pause  q quit"
+
+// Tree returns the node identifiers in tree order with their depth. The
+// nodes without parents are the roots and every node is listed once,
+// under the first of its parents in sorted order.
+func Tree(nodes []Node, links [][2]string) ([]string, []int) {
+	children := map[string][]string{}
+	hasParent := map[string]bool{}
+	for _, l := range links {
+		children[l[0]] = append(children[l[0]], l[1])
+		hasParent[l[1]] = true
+	}
+	for _, c := range children {
+		sort.Strings(c)
+	}
+
+	roots := []string{}
+	for _, n := range nodes {
+		if !hasParent[n.ID] {
+			roots = append(roots, n.ID)
+		}
+	}
+	sort.Strings(roots)
+
+	ids := []string{}
+	depths := []int{}
+	seen := map[string]bool{}
+	var walk func(id string, depth int)
+	walk = func(id string, depth int) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		ids = append(ids, id)
+		depths = append(depths, depth)
+		for _, c := range children[id] {
+			walk(c, depth+1)
+		}
+	}
+	for _, r := range roots {
+		walk(r, 0)
+	}
+
+	// nodes only reachable through a cycle
+	rest := []string{}
+	for _, n := range nodes {
+		if !seen[n.ID] {
+			rest = append(rest, n.ID)
+		}
+	}
+	sort.Strings(rest)
+	for _, id := range rest {
+		walk(id, 0)
+	}
+	return ids, depths
+}
+
+// Render lays the view out on a screen of the width and height.
+func Render(v View, width, height int) []string {
+	if width < 20 {
+		width = 20
+	}
+	if height < 10 {
+		height = 10
+	}
+
+	lines := []string{}
+	header := bold + v.Title + reset + "  " + status(v.Building, v.Paused)
+	if v.Duration > 0 {
+		header += dim + "  last build " + v.Duration.Round(time.Millisecond).String() + reset
+	}
+	lines = append(lines, header)
+
+	// the error and footer take the last lines, the nodes half
+	// of the rest and the output and log the other half
+	footer := []string{}
+	if v.Error != "" {
+		for _, l := range strings.Split(v.Error, "\n") {
+			footer = append(footer, red+clip(l, width)+reset)
+		}
+		if len(footer) > 3 {
+			footer = footer[:3]
+		}
+	}
+	footer = append(footer, dim+clip(Keys, width)+reset)
+
+	space := height - len(lines) - len(footer)
+	top := space / 2
+	bottom := space - top
+
+	if v.Graph {
+		lines = append(lines, rule("graph", width))
+		lines = append(lines, window(graph(v.Links, width), top-1, 0)...)
+	} else {
+		lines = append(lines, rule("nodes", width))
+		lines = append(lines, window(tree(v, width), top-1, v.Selected)...)
+	}
+
+	title := "output"
+	if v.Running != "" {
+		title += " " + v.Running
+	}
+	lines = append(lines, rule(title, width))
+	logLines := 0
+	if len(v.Log) > 0 {
+		logLines = (bottom - 2) / 3
+	}
+	lines = append(lines, tail(v.Output, bottom-1-logLines-min(logLines, 1), width)...)
+	if logLines > 0 {
+		lines = append(lines, rule("log", width))
+		lines = append(lines, tail(v.Log, logLines, width)...)
+	}
+
+	return append(lines, footer...)
+}
+
+func tree(v View, width int) []string {
+	states := map[string]string{}
+	for _, n := range v.Nodes {
+		states[n.ID] = n.State
+	}
+
+	ids, depths := Tree(v.Nodes, v.Links)
+	lines := make([]string, len(ids))
+	for i, id := range ids {
+		s := states[id]
+		name := strings.Repeat("  ", depths[i]) + id
+		pad := width - len(s) - 1
+		name = clip(name, pad-1)
+		gap := pad - len([]rune(name))
+		if gap < 1 {
+			gap = 1
+		}
+		line := name + strings.Repeat(" ", gap) + stateColors[s] + s + reset
+		if id == v.Running {
+			line = bold + line
+		}
+		if i == v.Selected {
+			line = invert + line
+		}
+		lines[i] = line + reset
+	}
+	return lines
+}
+
+func graph(links [][2]string, width int) []string {
+	lines := make([]string, len(links))
+	for i, l := range links {
+		lines[i] = clip(l[0]+" -> "+l[1], width)
+	}
+	return lines
+}
+
+// window returns the lines that fit in the height keeping the selected
+// line visible, padded to the height.
+func window(lines []string, height, selected int) []string {
+	if height < 0 {
+		height = 0
+	}
+	start := 0
+	if selected >= height {
+		start = selected - height + 1
+	}
+	end := start + height
+	if end > len(lines) {
+		end = len(lines)
+	}
+	if start > end {
+		start = end
+	}
+	out := append([]string{}, lines[start:end]...)
+	for len(out) < height {
+		out = append(out, "")
+	}
+	return out
+}
+
+// tail returns the last lines that fit in the height, padded to the height.
+func tail(lines []string, height, width int) []string {
+	if height < 0 {
+		height = 0
+	}
+	start := 0
+	if len(lines) > height {
+		start = len(lines) - height
+	}
+	out := []string{}
+	for _, l := range lines[start:] {
+		out = append(out, clip(l, width))
+	}
+	for len(out) < height {
+		out = append(out, "")
+	}
+	return out
+}
+
+func rule(title string, width int) string {
+	t := "── " + title + " "
+	n := width - len([]rune(t))
+	if n < 0 {
+		n = 0
+	}
+	return dim + t + strings.Repeat("─", n) + reset
+}
+
+func clip(s string, width int) string {
+	r := []rune(s)
+	if len(r) <= width {
+		return s
+	}
+	if width < 1 {
+		return ""
+	}
+	return string(r[:width-1]) + "…"
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// status returns the status text of the session.
+func status(building, paused bool) string {
+	switch {
+	case building:
+		return yellow + "building" + reset
+	case paused:
+		return dim + "paused" + reset
+	}
+	return green + "watching" + reset
+}
@@ -0,0 +1,71 @@
+package tui_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oligoden/meta/tui"
+	"github.com/stretchr/testify/assert"
+)
+
+var ansi = regexp.MustCompile("\x1b\\[[0-9;?]*[a-zA-Z]")
+
+func plain(lines []string) string {
+	return ansi.ReplaceAllString(strings.Join(lines, "\n"), "")
+}
+
+func TestTree(t *testing.T) {
+	nodes := []tui.Node{
+		{ID: "prj:p"}, {ID: "dir:a:a"}, {ID: "file:a/x.ext"}, {ID: "exec:build"},
+	}
+	links := [][2]string{
+		{"prj:p", "dir:a:a"},
+		{"dir:a:a", "file:a/x.ext"},
+		{"prj:p", "exec:build"},
+		{"file:a/x.ext", "exec:build"},
+	}
+
+	ids, depths := tui.Tree(nodes, links)
+	assert.Equal(t, []string{"prj:p", "dir:a:a", "file:a/x.ext", "exec:build"}, ids)
+	assert.Equal(t, []int{0, 1, 2, 3}, depths)
+}
+
+func TestRender(t *testing.T) {
+	assert := assert.New(t)
+
+	v := tui.View{
+		Title:    "meta up p",
+		Building: true,
+		Nodes:    []tui.Node{{ID: "prj:p", State: "stable"}, {ID: "file:x.ext", State: "updated"}},
+		Links:    [][2]string{{"prj:p", "file:x.ext"}},
+		Running:  "exec:build",
+		Output:   []string{"[build] one", "[build] two"},
+		Duration: 1500 * time.Millisecond,
+		Error:    "error performing actions on exec:build",
+	}
+
+	lines := tui.Render(v, 40, 16)
+	assert.Len(lines, 16)
+
+	screen := plain(lines)
+	assert.Contains(screen, "meta up p  building  last build 1.5s")
+	assert.Regexp(`\nprj:p +stable\n  file:x.ext +updated\n`, screen)
+	assert.Contains(screen, "── output exec:build")
+	assert.Contains(screen, "[build] two")
+	assert.Contains(screen, "error performing actions on exec:build")
+	assert.Contains(screen, "f force")
+
+	// long names are clipped on narrow screens
+	long := v
+	long.Nodes = []tui.Node{{ID: "prj:p", State: "stable"}, {ID: "file:a/very/long/path.ext", State: "updated"}}
+	long.Links = [][2]string{{"prj:p", "file:a/very/long/path.ext"}}
+	screen = plain(tui.Render(long, 20, 16))
+	assert.Contains(screen, "\n  file:a/v… updated\n")
+
+	v.Graph = true
+	screen = plain(tui.Render(v, 40, 16))
+	assert.Contains(screen, "── graph")
+	assert.Contains(screen, "prj:p -> file:x.ext")
+}
@@ -0,0 +1,82 @@
+package watch
+
+import (
+	"time"
+)
+
+// Debouncer coalesces events by path until no new event arrived for
+// the window. Chmod only events are dropped since they do not change
+// the contents of a file.
+type Debouncer struct {
+	window  time.Duration
+	pending map[string]Op
+	order   []string
+	timer   *time.Timer
+}
+
+func NewDebouncer(window time.Duration) *Debouncer {
+	return &Debouncer{
+		window:  window,
+		pending: map[string]Op{},
+	}
+}
+
+// Add adds the event to the pending batch and restarts the window.
+// The operations on a path are merged, where a later create or write
+// cancels an earlier remove or rename and the other way around.
+func (d *Debouncer) Add(e Event) {
+	op := e.Op &^ Chmod
+	if op == 0 {
+		return
+	}
+
+	prev, found := d.pending[e.Path]
+	if !found {
+		d.order = append(d.order, e.Path)
+	}
+	if op&(Create|Write) != 0 {
+		prev &^= Remove | Rename
+	}
+	if op&(Remove|Rename) != 0 {
+		prev &^= Create | Write
+	}
+	d.pending[e.Path] = prev | op
+
+	if d.timer == nil {
+		d.timer = time.NewTimer(d.window)
+		return
+	}
+	if !d.timer.Stop() {
+		select {
+		case <-d.timer.C:
+		default:
+		}
+	}
+	d.timer.Reset(d.window)
+}
+
+// C returns the channel that fires when the window of the pending batch
+// passed. It is nil when no events are pending.
+func (d *Debouncer) C() <-chan time.Time {
+	if d.timer == nil {
+		return nil
+	}
+	return d.timer.C
+}
+
+// Flush returns the pending events in the order they were first seen
+// and starts a new batch.
+func (d *Debouncer) Flush() []Event {
+	events := make([]Event, 0, len(d.order))
+	for _, path := range d.order {
+		events = append(events, Event{Path: path, Op: d.pending[path]})
+	}
+
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.pending = map[string]Op{}
+	d.order = nil
+	return events
+}
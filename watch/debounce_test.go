@@ -0,0 +1,43 @@
+package watch_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oligoden/meta/watch"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebouncer(t *testing.T) {
+	assert := assert.New(t)
+
+	d := watch.NewDebouncer(50 * time.Millisecond)
+	assert.Nil(d.C())
+
+	d.Add(watch.Event{Path: "a", Op: watch.Chmod})
+	assert.Nil(d.C())
+
+	start := time.Now()
+	d.Add(watch.Event{Path: "a", Op: watch.Write})
+	d.Add(watch.Event{Path: "b", Op: watch.Remove})
+	time.Sleep(30 * time.Millisecond)
+	d.Add(watch.Event{Path: "a", Op: watch.Write | watch.Chmod})
+	d.Add(watch.Event{Path: "b", Op: watch.Create})
+	d.Add(watch.Event{Path: "c", Op: watch.Create})
+	d.Add(watch.Event{Path: "c", Op: watch.Rename})
+
+	select {
+	case <-d.C():
+	case <-time.After(time.Second):
+		t.Fatal("debouncer did not fire")
+	}
+	assert.True(time.Since(start) >= 80*time.Millisecond)
+
+	assert.Equal([]watch.Event{
+		{Path: "a", Op: watch.Write},
+		{Path: "b", Op: watch.Create},
+		{Path: "c", Op: watch.Rename},
+	}, d.Flush())
+	assert.Nil(d.C())
+	assert.Empty(d.Flush())
+}
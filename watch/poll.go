@@ -0,0 +1,281 @@
+package watch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Poller watches directories by periodically comparing the modification
+// time and size of the files, for file systems that do not deliver
+// notifications such as network and container mounted volumes.
+type Poller struct {
+	Events chan Event
+	Errors chan error
+
+	skipPath func(path string, isDir bool) bool
+	hash     bool
+	mu       sync.Mutex
+	interval time.Duration
+	roots    []Dir
+	files    map[string]stat
+	dirs     []string
+	done     chan struct{}
+	closed   sync.Once
+}
+
+type stat struct {
+	mod  time.Time
+	size int64
+	hash string
+}
+
+// NewPoller starts a poller polling every interval. With hash it also
+// compares the contents of the files, catching changes that keep the
+// size within the resolution of the modification time. The skip
+// function, which may be nil, reports paths that should not be watched
+// or reported.
+func NewPoller(interval time.Duration, hash bool, skip func(path string, isDir bool) bool) *Poller {
+	p := &Poller{
+		Events:   make(chan Event),
+		Errors:   make(chan error),
+		skipPath: skip,
+		hash:     hash,
+		interval: interval,
+		files:    map[string]stat{},
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Sync updates the polled directories to cover exactly the given
+// directories. Files in directories that were not covered before are
+// recorded without being reported.
+func (p *Poller) Sync(dirs ...Dir) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fresh, scanned, err := p.scan(dirs)
+	if err != nil {
+		return err
+	}
+
+	files := map[string]stat{}
+	for path, s := range fresh {
+		if old, ok := p.files[path]; ok {
+			files[path] = old
+		} else if !covered(path, p.roots) {
+			files[path] = s
+		}
+	}
+	for path, old := range p.files {
+		if _, ok := fresh[path]; !ok && covered(path, dirs) {
+			// removed since the last poll, reported on the next one
+			files[path] = old
+		}
+	}
+
+	p.roots = dirs
+	p.files = files
+	p.dirs = scanned
+	return nil
+}
+
+// Watched returns the polled directories in sorted order.
+func (p *Poller) Watched() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]string{}, p.dirs...)
+}
+
+func (p *Poller) Channels() (<-chan Event, <-chan error) {
+	return p.Events, p.Errors
+}
+
+// Close stops the poller. Closing it again does nothing.
+func (p *Poller) Close() error {
+	p.closed.Do(func() {
+		close(p.done)
+	})
+	return nil
+}
+
+func (p *Poller) run() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			events, err := p.poll()
+			if err != nil && !p.send(nil, err) {
+				return
+			}
+			for _, e := range events {
+				if !p.send(&e, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// poll scans the directories and returns the changes since the last poll.
+func (p *Poller) poll() ([]Event, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	files, dirs, err := p.scan(p.roots)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []Event{}
+	for path, s := range files {
+		old, ok := p.files[path]
+		if !ok {
+			events = append(events, Event{Path: path, Op: Create})
+		} else if s != old {
+			events = append(events, Event{Path: path, Op: Write})
+		}
+	}
+	for path := range p.files {
+		if _, ok := files[path]; !ok {
+			events = append(events, Event{Path: path, Op: Remove})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Path < events[j].Path
+	})
+
+	p.files = files
+	p.dirs = dirs
+	return events, nil
+}
+
+func (p *Poller) scan(roots []Dir) (map[string]stat, []string, error) {
+	files := map[string]stat{}
+	dirs := []string{}
+
+	for _, d := range roots {
+		root := filepath.Clean(d.Path)
+		info, err := os.Stat(root)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, nil, err
+		}
+		if !info.IsDir() || p.skip(root, true) {
+			continue
+		}
+
+		err = filepath.WalkDir(root, func(path string, de fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+
+			if de.IsDir() {
+				if path == root {
+					dirs = append(dirs, path)
+					return nil
+				}
+				if !d.Recursive || p.skip(path, true) {
+					return filepath.SkipDir
+				}
+				dirs = append(dirs, path)
+				return nil
+			}
+
+			if p.skip(path, false) {
+				return nil
+			}
+			info, err := de.Info()
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+
+			s := stat{mod: info.ModTime(), size: info.Size()}
+			if p.hash {
+				s.hash = hash(path)
+			}
+			files[path] = s
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sort.Strings(dirs)
+	return files, dirs, nil
+}
+
+func (p *Poller) skip(path string, isDir bool) bool {
+	return p.skipPath != nil && p.skipPath(path, isDir)
+}
+
+func (p *Poller) send(event *Event, err error) bool {
+	if event != nil {
+		select {
+		case p.Events <- *event:
+		case <-p.done:
+			return false
+		}
+		return true
+	}
+
+	select {
+	case p.Errors <- err:
+	case <-p.done:
+		return false
+	}
+	return true
+}
+
+// covered reports whether the file falls under one of the directories.
+func covered(path string, dirs []Dir) bool {
+	for _, d := range dirs {
+		root := filepath.Clean(d.Path)
+		if !d.Recursive {
+			if filepath.Dir(path) == root {
+				return true
+			}
+			continue
+		}
+		if within(path, root) {
+			return true
+		}
+	}
+	return false
+}
+
+func hash(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
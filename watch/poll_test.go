@@ -0,0 +1,92 @@
+package watch_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oligoden/meta/watch"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoller(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, dir := range []string{"testing/a/b", "testing/skip", "testing/other"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.RemoveAll("testing")
+
+	for name, content := range map[string]string{
+		"testing/a/x.ext":     "x",
+		"testing/a/b/y.ext":   "y",
+		"testing/skip/z.ext":  "z",
+		"testing/other/o.ext": "o",
+	} {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := watch.NewPoller(20*time.Millisecond, true, func(path string, isDir bool) bool {
+		return strings.HasSuffix(path, "skip")
+	})
+	defer p.Close()
+
+	assert.NoError(p.Sync(
+		watch.Dir{Path: "testing"},
+		watch.Dir{Path: "testing/a", Recursive: true},
+	))
+	assert.Equal([]string{"testing", "testing/a", "testing/a/b"}, p.Watched())
+
+	// same size and modification time, only the hash differs
+	info, err := os.Stat("testing/a/x.ext")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("testing/a/x.ext", []byte("X"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes("testing/a/x.ext", info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove("testing/a/b/y.ext"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("testing/a/b/new.ext", []byte("n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]watch.Op{
+		"testing/a/x.ext":     watch.Write,
+		"testing/a/b/y.ext":   watch.Remove,
+		"testing/a/b/new.ext": watch.Create,
+	}
+	events := map[string]watch.Op{}
+	timeout := time.After(2 * time.Second)
+	for len(events) < len(expected) {
+		select {
+		case e := <-p.Events:
+			events[e.Path] |= e.Op
+		case err := <-p.Errors:
+			t.Fatal(err)
+		case <-timeout:
+			t.Fatal("missing events", events)
+		}
+	}
+	assert.Equal(expected, events)
+
+	// files of newly synced directories are not reported
+	assert.NoError(p.Sync(
+		watch.Dir{Path: "testing", Recursive: true},
+	))
+	select {
+	case e := <-p.Events:
+		t.Fatal("unexpected event", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,347 @@
+// Package watch reports changes to the source directories of a project.
+// Directories are watched recursively and watches are added and removed
+// as directories appear, disappear or the set of watched roots changes.
+package watch
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Op describes the change to a path.
+type Op uint32
+
+const (
+	Create Op = 1 << iota
+	Write
+	Remove
+	Rename
+	Chmod
+)
+
+func (op Op) String() string {
+	names := []string{}
+	for _, o := range []struct {
+		op   Op
+		name string
+	}{
+		{Create, "CREATE"},
+		{Write, "WRITE"},
+		{Remove, "REMOVE"},
+		{Rename, "RENAME"},
+		{Chmod, "CHMOD"},
+	} {
+		if op&o.op == o.op {
+			names = append(names, o.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// Event is a change to a watched path.
+type Event struct {
+	Path string
+	Op   Op
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%s %s", e.Op, e.Path)
+}
+
+// Watcher reports changes to a set of directories. Recursive uses file
+// system notifications and Poller compares the files periodically.
+type Watcher interface {
+	Sync(dirs ...Dir) error
+	Watched() []string
+	Channels() (<-chan Event, <-chan error)
+	Close() error
+}
+
+// Dir is a directory to watch.
+type Dir struct {
+	Path      string
+	Recursive bool
+}
+
+// Recursive watches directories and their subdirectories with fsnotify.
+type Recursive struct {
+	Events chan Event
+	Errors chan error
+
+	skipPath func(path string, isDir bool) bool
+	mu       sync.Mutex
+	w        *fsnotify.Watcher
+	roots    []Dir
+	watched  map[string]bool
+	done     chan struct{}
+	closed   sync.Once
+}
+
+// New starts a watcher. The skip function, which may be nil, reports
+// paths that should not be watched or reported.
+func New(skip func(path string, isDir bool) bool) (*Recursive, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recursive{
+		Events:   make(chan Event),
+		Errors:   make(chan error),
+		skipPath: skip,
+		w:        w,
+		watched:  map[string]bool{},
+		done:     make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+// Sync updates the watches to cover exactly the given directories.
+// Directories that do not exist are ignored.
+func (r *Recursive) Sync(dirs ...Dir) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.roots = dirs
+
+	want := map[string]bool{}
+	for _, d := range dirs {
+		err := r.collect(filepath.Clean(d.Path), d.Recursive, want)
+		if err != nil {
+			return err
+		}
+	}
+
+	for path := range r.watched {
+		if !want[path] {
+			r.w.Remove(path)
+			delete(r.watched, path)
+		}
+	}
+
+	paths := make([]string, 0, len(want))
+	for path := range want {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if r.watched[path] {
+			continue
+		}
+		err := r.w.Add(path)
+		if err != nil {
+			return fmt.Errorf("watching %s, %w", path, err)
+		}
+		r.watched[path] = true
+	}
+
+	return nil
+}
+
+// Watched returns the watched directories in sorted order.
+func (r *Recursive) Watched() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	paths := []string{}
+	for path := range r.watched {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (r *Recursive) Channels() (<-chan Event, <-chan error) {
+	return r.Events, r.Errors
+}
+
+// Close stops the watcher. Closing it again does nothing, as a watcher
+// replaced on a reload may be closed again on shutdown.
+func (r *Recursive) Close() error {
+	var err error
+	r.closed.Do(func() {
+		close(r.done)
+		err = r.w.Close()
+	})
+	return err
+}
+
+func (r *Recursive) collect(root string, recursive bool, want map[string]bool) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if !info.IsDir() || r.skip(root, true) {
+		return nil
+	}
+
+	if !recursive {
+		want[root] = true
+		return nil
+	}
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && r.skip(path, true) {
+			return filepath.SkipDir
+		}
+		want[path] = true
+		return nil
+	})
+}
+
+func (r *Recursive) skip(path string, isDir bool) bool {
+	return r.skipPath != nil && r.skipPath(path, isDir)
+}
+
+// recursive reports whether the path falls under a recursive root.
+func (r *Recursive) recursive(path string) bool {
+	for _, d := range r.roots {
+		if !d.Recursive {
+			continue
+		}
+		if within(path, filepath.Clean(d.Path)) {
+			return true
+		}
+	}
+	return false
+}
+
+// within reports whether the path is the root or below it.
+func within(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (r *Recursive) run() {
+	for {
+		select {
+		case <-r.done:
+			return
+		case event, ok := <-r.w.Events:
+			if !ok {
+				return
+			}
+			r.handle(event)
+		case err, ok := <-r.w.Errors:
+			if !ok {
+				return
+			}
+			r.send(nil, err)
+		}
+	}
+}
+
+func (r *Recursive) handle(event fsnotify.Event) {
+	path := filepath.Clean(event.Name)
+	op := Op(0)
+	for _, o := range []struct {
+		from fsnotify.Op
+		to   Op
+	}{
+		{fsnotify.Create, Create},
+		{fsnotify.Write, Write},
+		{fsnotify.Remove, Remove},
+		{fsnotify.Rename, Rename},
+		{fsnotify.Chmod, Chmod},
+	} {
+		if event.Op&o.from == o.from {
+			op |= o.to
+		}
+	}
+
+	events := []Event{}
+
+	r.mu.Lock()
+	if op&(Remove|Rename) != 0 {
+		for watched := range r.watched {
+			if watched == path || strings.HasPrefix(watched, path+string(filepath.Separator)) {
+				r.w.Remove(watched)
+				delete(r.watched, watched)
+			}
+		}
+	}
+
+	if op&Create == Create {
+		info, err := os.Stat(path)
+		if err == nil && info.IsDir() {
+			if r.skip(path, true) || !r.recursive(path) {
+				r.mu.Unlock()
+				return
+			}
+
+			// files created in the new directory before the watch was
+			// added are reported as created as well
+			filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return nil
+				}
+				if d.IsDir() {
+					if p != path && r.skip(p, true) {
+						return filepath.SkipDir
+					}
+					if !r.watched[p] && r.w.Add(p) == nil {
+						r.watched[p] = true
+					}
+					return nil
+				}
+				if !r.skip(p, false) {
+					events = append(events, Event{Path: p, Op: Create})
+				}
+				return nil
+			})
+			r.mu.Unlock()
+
+			for _, e := range events {
+				if !r.send(&e, nil) {
+					return
+				}
+			}
+			return
+		}
+	}
+	r.mu.Unlock()
+
+	if r.skip(path, false) {
+		return
+	}
+	r.send(&Event{Path: path, Op: op}, nil)
+}
+
+func (r *Recursive) send(event *Event, err error) bool {
+	if event != nil {
+		select {
+		case r.Events <- *event:
+		case <-r.done:
+			return false
+		}
+		return true
+	}
+
+	select {
+	case r.Errors <- err:
+	case <-r.done:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package watch_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oligoden/meta/watch"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecursive(t *testing.T) {
+	assert := assert.New(t)
+
+	if err := os.MkdirAll("testing/a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll("testing/skip", 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll("testing")
+
+	w, err := watch.New(func(path string, isDir bool) bool {
+		return strings.HasSuffix(path, "skip")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	assert.NoError(w.Sync(
+		watch.Dir{Path: "testing"},
+		watch.Dir{Path: "testing/a", Recursive: true},
+		watch.Dir{Path: "testing/none", Recursive: true},
+	))
+	assert.Equal([]string{"testing", "testing/a", "testing/a/b"}, w.Watched())
+
+	if err := os.MkdirAll("testing/a/c/d", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("testing/a/c/d/x.ext", []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	events := map[string]watch.Op{}
+	timeout := time.After(2 * time.Second)
+	for events[filepath.Join("testing", "a", "c", "d", "x.ext")]&watch.Create == 0 {
+		select {
+		case e := <-w.Events:
+			events[e.Path] |= e.Op
+		case err := <-w.Errors:
+			t.Fatal(err)
+		case <-timeout:
+			t.Fatal("no create event for new file", events)
+		}
+	}
+	assert.Contains(w.Watched(), "testing/a/c/d")
+
+	assert.NoError(w.Sync(watch.Dir{Path: "testing/a/b", Recursive: true}))
+	assert.Equal([]string{"testing/a/b"}, w.Watched())
+}
+
+func TestClose(t *testing.T) {
+	w, err := watch.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, w.Close())
+	assert.NoError(t, w.Close())
+
+	p := watch.NewPoller(time.Second, false, nil)
+	assert.NoError(t, p.Close())
+	assert.NoError(t, p.Close())
+}
+
+func TestOpString(t *testing.T) {
+	assert.Equal(t, "CREATE|WRITE", (watch.Create | watch.Write).String())
+}